@@ -1,8 +1,93 @@
 function PLUGIN:EnvKeys(ctx)
-    return {
+    local host = require("host")
+    local companions = require("companions")
+    local replset = require("replset")
+
+    local result = {
         {
             key = "PATH",
             value = ctx.path .. "/bin",
         },
     }
+    for _, bin in ipairs(companions.bin_dirs(ctx.path)) do
+        table.insert(result, {
+            key = "PATH",
+            value = bin,
+        })
+    end
+
+    table.insert(result, {
+        key = "MONGOD_HOME",
+        value = ctx.path,
+    })
+    local version = installed_version(ctx)
+    if version then
+        table.insert(result, {
+            key = "MONGOD_VERSION",
+            value = version,
+        })
+    end
+
+    -- The replica set is started by mongod-replset (see replset.lua) or, with MONGOD_REPLSET_AUTOSTART, right here;
+    -- neither an invalid configuration nor a failed start must prevent the activation of the environment.
+    local rcOk, config = pcall(replset.config)
+    if not rcOk then
+        host.warn((tostring(config):gsub("^[^:]+:%d+: ", "")))
+    elseif config then
+        local started = true
+        local autostart = os.getenv("MONGOD_REPLSET_AUTOSTART")
+        if autostart == "1" or autostart == "true" or autostart == "yes" then
+            local rsOk, err = pcall(replset.start, ctx.path, config)
+            if not rsOk then
+                host.warn((tostring(err):gsub("^[^:]+:%d+: ", "")))
+                started = false
+            end
+        end
+        if started then
+            table.insert(result, {
+                key = "MONGOD_REPLSET_URI",
+                value = replset.uri(config),
+            })
+        end
+    end
+
+    local export_details = os.getenv("MONGOD_EXPORT_DETAILS")
+    if export_details == "1" or export_details == "true" or export_details == "yes" then
+        local Target = require("Target")
+
+        -- MONGOD_EDITION itself is an input; exporting it would shadow the setting of the user. An invalid one
+        -- must only fail installations, not the activation of the environment.
+        local heOk, edition = pcall(host.edition)
+        if heOk then
+            table.insert(result, {
+                key = "MONGOD_EDITION_RESOLVED",
+                value = edition,
+            })
+        else
+            host.warn((tostring(edition):gsub("^[^:]+:%d+: ", "")))
+        end
+        local thOk, target = pcall(Target.host_string)
+        if thOk then
+            table.insert(result, {
+                key = "MONGOD_TARGET_RESOLVED",
+                value = target,
+            })
+        else
+            host.warn((tostring(target):gsub("^[^:]+:%d+: ", "")))
+        end
+    end
+
+    return result
+end
+
+-- The runtimes differ in where they provide the version: vfox inside ctx.main and ctx.sdkInfo, MISE (partially)
+-- only as ctx.version.
+function installed_version(ctx)
+    if type(ctx.main) == "table" and ctx.main.version then
+        return ctx.main.version
+    end
+    if type(ctx.sdkInfo) == "table" and type(ctx.sdkInfo[PLUGIN.name]) == "table" and ctx.sdkInfo[PLUGIN.name].version then
+        return ctx.sdkInfo[PLUGIN.name].version
+    end
+    return ctx.version
 end
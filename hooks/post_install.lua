@@ -3,13 +3,50 @@ function PLUGIN:PostInstall(ctx)
 
     local sdkInfo = ctx.sdkInfo[PLUGIN.name]
 
+    verify_archive_if_present(sdkInfo)
     apply_ugly_workaround_if_required(sdkInfo)
 
     local exe = host.path_join(sdkInfo.path, "bin", host.with_exec_ext("mongod"))
+    if not host.can_read(exe) then
+        error(string.format("%s installation appears to be broken: %s does not exist", PLUGIN.name, exe))
+    end
     local success, err = pcall(host.exec, exe .. " -version")
     if not success then
         error(string.format("%s installation appears to be broken: got error while testing %s: %s", PLUGIN.name, exe, tostring(err)))
     end
+
+    local companions = require("companions")
+    companions.install(sdkInfo.path)
+
+    local instance = require("instance")
+    instance.install(sdkInfo.path, sdkInfo.version)
+
+    local replset = require("replset")
+    replset.install(sdkInfo.path, sdkInfo.version)
+end
+
+-- Usually the runtime already verified the archive (see PreInstall) and removed it after extraction.
+-- But if it is still there (see the workaround below), it has not been touched yet, so verify it
+-- against the checksum PreInstall remembered before anything of it gets executed.
+function verify_archive_if_present(sdkInfo)
+    local checksum = require("checksum")
+
+    local archiveFn = find_archive(sdkInfo.path)
+    if archiveFn then
+        checksum.verify_remembered(archiveFn)
+    end
+end
+
+-- Returns the archive (.tgz, .tar.gz or .zip) which was left inside the given installation or nil.
+function find_archive(path)
+    local host = require("host")
+
+    for _, name in ipairs(host.list_dir(path)) do
+        if name:match("%.tgz$") or name:match("%.tar%.gz$") or name:match("%.zip$") then
+            return host.path_join(path, name)
+        end
+    end
+    return nil
 end
 
 -- --------------------------------------------------------------------------------------------------
@@ -24,13 +61,14 @@ function apply_ugly_workaround_if_required(sdkInfo)
         return
     end
 
-    local versions = require("versions")
     local archiver = require("archiver")
 
-    local version = versions.get(sdkInfo.version)
     local path = sdkInfo.path
 
-    local origArchiveFn = host.path_join(path, version.url:match("([^/\\]+)$"))
+    local origArchiveFn = find_archive(path)
+    if not origArchiveFn then
+        return
+    end
     local archiveFn = origArchiveFn:gsub("%.tgz$", ".tar.gz")
 
     -- This will only work if the source archive does exist and both filenames are different.
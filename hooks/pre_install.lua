@@ -2,13 +2,18 @@ function PLUGIN:PreInstall(ctx)
     local versions = require("versions")
     local host = require("host")
     local Target = require("Target")
+    local checksum = require("checksum")
 
     local version = versions.get(ctx.version)
+    local algorithm, expected = checksum.of(version)
+    -- PostInstall may find the archive again (see verify_archive_if_present).
+    checksum.remember(version.url:match("([^/\\]+)$"), algorithm, expected)
 
     return {
         version = version.version,
         url = version.url,
-        sha256 = version.sha256,
+        sha256 = algorithm == "sha256" and expected or nil,
+        sha1 = algorithm == "sha1" and expected or nil,
         note = string.format("Downloading %s/%s@%s ", Target.host_string(), host.arch(), version.version),
     }
 end
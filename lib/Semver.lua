@@ -4,6 +4,81 @@ local Semver = {}
 Semver.__index = Semver
 Semver.__type = "Semver"
 
+-- Checks the dot separated identifiers of a pre-release or build metadata.
+-- Numeric identifiers of pre-releases must not contain leading zeros.
+local function valid_identifiers(s, is_pre_release)
+    for identifier in (s .. "."):gmatch("(.-)%.") do
+        if identifier == "" or identifier:match("[^%w%-]") then
+            return false
+        end
+        if is_pre_release and identifier:match("^0%d+$") then
+            return false
+        end
+    end
+    return true
+end
+
+-- Compares two alphanumeric identifiers lexically in ASCII order. With
+-- numeric_suffixes, the text before a numeric suffix is compared first and
+-- then the suffix numerically, so rc2 is lower than rc10.
+local function cmp_alphanumeric(a, b, numeric_suffixes)
+    if numeric_suffixes then
+        local a_text, a_suffix = a:match("^(.-)(%d*)$")
+        local b_text, b_suffix = b:match("^(.-)(%d*)$")
+        if a_text ~= b_text then
+            return a_text > b_text and 1 or -1
+        end
+        local a_n, b_n = tonumber(a_suffix), tonumber(b_suffix)
+        if a_n ~= b_n then
+            if not a_n or not b_n then
+                return a_n and 1 or -1
+            end
+            return a_n > b_n and 1 or -1
+        end
+    end
+    if a == b then
+        return 0
+    end
+    return a > b and 1 or -1
+end
+
+-- Compares dot separated pre-release identifiers as defined by SemVer 2.0:
+-- numeric identifiers numerically, alphanumeric ones lexically in ASCII order
+-- (see cmp_alphanumeric), numeric ones lower than alphanumeric ones and a
+-- larger set of identifiers higher than a smaller one if all preceding ones
+-- are equal.
+local function cmp_identifiers(a, b, numeric_suffixes)
+    local a_ids, b_ids = {}, {}
+    for id in (a .. "."):gmatch("(.-)%.") do
+        table.insert(a_ids, id)
+    end
+    for id in (b .. "."):gmatch("(.-)%.") do
+        table.insert(b_ids, id)
+    end
+
+    for i = 1, math.min(#a_ids, #b_ids) do
+        local a_id, b_id = a_ids[i], b_ids[i]
+        local a_n, b_n = a_id:match("^%d+$") and tonumber(a_id), b_id:match("^%d+$") and tonumber(b_id)
+
+        if a_n and b_n then
+            if a_n ~= b_n then
+                return a_n > b_n and 1 or -1
+            end
+        elseif a_n then
+            return -1
+        elseif b_n then
+            return 1
+        elseif a_id ~= b_id then
+            return cmp_alphanumeric(a_id, b_id, numeric_suffixes)
+        end
+    end
+
+    if #a_ids == #b_ids then
+        return 0
+    end
+    return #a_ids > #b_ids and 1 or -1
+end
+
 function Semver:new(s)
     local result = setmetatable({}, self)
 
@@ -16,22 +91,61 @@ function Semver:new(s)
         return nil
     end
 
-    local M, m, p = s:match("^%s*[vV]?(%d+)%.(%d+)%.(%d+)%s*$")
+    local M, m, p, rest = s:match("^%s*[vV]?(%d+)%.(%d+)%.(%d+)(.-)%s*$")
     if not M then
         return nil
     end
+
+    local pre, build = rest:match("^%-([^+]+)%+(.+)$")
+    if not pre then
+        pre = rest:match("^%-([^+]+)$")
+        build = rest:match("^%+(.+)$")
+        if not pre and not build and rest ~= "" then
+            return nil
+        end
+    end
+    if pre and not valid_identifiers(pre, true) then
+        return nil
+    end
+    if build and not valid_identifiers(build, false) then
+        return nil
+    end
+
     result.major = tonumber(M)
     result.minor = tonumber(m)
     result.patch = tonumber(p)
+    result.prerelease = pre
+    result.build = build
 
     return result
 end
 
 function Semver:__tostring()
-    return ("%d.%d.%d"):format(self.major, self.minor, self.patch)
+    local result = ("%d.%d.%d"):format(self.major, self.minor, self.patch)
+    if self.prerelease then
+        result = result .. "-" .. self.prerelease
+    end
+    if self.build then
+        result = result .. "+" .. self.build
+    end
+    return result
+end
+
+-- Returns a copy of this version without pre-release and build metadata.
+function Semver:core()
+    return Semver:new(("%d.%d.%d"):format(self.major, self.minor, self.patch))
 end
 
-function Semver.cmp(a, b)
+function Semver:__tojson()
+    return tostring(self)
+end
+
+-- Compares two versions (or strings of them) by their precedence as defined
+-- by SemVer 2.0 and returns 1, 0 or -1. If options.numeric_suffixes is true,
+-- numeric suffixes of pre-release identifiers are compared numerically, so
+-- 1.0.0-rc10 is higher than 1.0.0-rc2 (as MongoDB numbers its release
+-- candidates) while SemVer 2.0 orders it lower.
+function Semver.cmp(a, b, options)
     if type(a) == "string" then
         a = Semver:new(a)
     end
@@ -82,7 +196,19 @@ function Semver.cmp(a, b)
         return -1
     end
 
-    return 0
+    -- A pre-release has a lower precedence than its normal version; build
+    -- metadata is always ignored.
+    if not a.prerelease and not b.prerelease then
+        return 0
+    end
+    if not a.prerelease then
+        return 1
+    end
+    if not b.prerelease then
+        return -1
+    end
+
+    return cmp_identifiers(a.prerelease, b.prerelease, options and options.numeric_suffixes)
 end
 
 return Semver
@@ -224,6 +224,46 @@ function Target:equals(other)
     return Version.cmp(self.version, other.version) == 0
 end
 
+-- Returns the one of the given items which fits best to this target: either
+-- the one for exactly this target or otherwise the one for the newest
+-- version of the same distribution, which is not newer than this target.
+-- target_of returns the target (as string) of the given item.
+function Target:best_of(items, target_of)
+    local debug = host.is_debug()
+    local result, result_version
+    for _, item in ipairs(items) do
+        local ok, item_target = pcall(Target.new, Target, target_of(item))
+        if ok and self:equals(item_target) then
+            if debug then
+                host.debug("Candidate matches the target exactly.", { candidate = target_of(item), target = tostring(self) })
+            end
+            return item
+        end
+        if ok and self:equals_base(item_target) and item_target.version and Version.cmp(self.version, item_target.version) >= 0 then
+            if not result or Version.cmp(item_target.version, result_version) > 0 then
+                if debug then
+                    host.debug("Candidate is an older version of the same distribution; using it as fallback.", { candidate = target_of(item), target = tostring(self) })
+                end
+                result = item
+                result_version = item_target.version
+            elseif debug then
+                host.debug("Candidate rejected: the fallback found so far is newer.", { candidate = target_of(item), target = tostring(self) })
+            end
+        elseif debug then
+            local reason
+            if not ok then
+                reason = "Candidate rejected: its target cannot be interpreted."
+            elseif not self:equals_base(item_target) then
+                reason = "Candidate rejected: other operating system or distribution."
+            else
+                reason = "Candidate rejected: newer version than the target."
+            end
+            host.debug(reason, { candidate = tostring(target_of(item)), target = tostring(self) })
+        end
+    end
+    return result
+end
+
 local function safeget(o, key)
   local ok, res = pcall(function() return o[key] end)
   return ok and res or nil
@@ -232,6 +272,7 @@ end
 function Target.host(os, os_release_fn)
     local overwriteEnv = cos.getenv("MONGOD_TARGET")
     if overwriteEnv then
+        host.debug("Target is overridden by MONGOD_TARGET.", { target = overwriteEnv })
         return Target:new(overwriteEnv)
     end
 
@@ -240,6 +281,7 @@ function Target.host(os, os_release_fn)
     end
 
     if os == "windows" or os == "macos" then
+        host.debug("Target is the operating system.", { os = os })
         return Target:new({
             os = os,
         })
@@ -249,6 +291,7 @@ function Target.host(os, os_release_fn)
         -- The following is only used in tests...
         local distributionOverwrite, versionOverwrite = safeget(RUNTIME, "distributionType"), safeget(RUNTIME, "distributionVersion")
         if distributionOverwrite and versionOverwrite then
+            host.debug("Distribution is provided by the runtime.", { distribution = distributionOverwrite, version = versionOverwrite })
             local version = Version:new(versionOverwrite)
             return Target:new({
                 os = "linux",
@@ -273,19 +316,23 @@ function Target.host(os, os_release_fn)
             if not version_id then
                 error("Illegal content of /etc/os-release: cannot find VERSION_ID entry")
             end
+            host.debug("Read os-release.", { file = os_release_fn, id = id, id_like = id_like, version_id = version_id })
 
             for distribution, settings in pairs(Target.__distributions) do
                 local match = id_match(distribution, id, id_like)
 
+                local matched_by = match and distribution
                 if not match and type(settings.aliases) == "table" then
                     for _, alias in ipairs(settings.aliases) do
                         if id_match(alias, id, id_like) then
                             match = true
+                            matched_by = alias
                         end
                     end
                 end
 
                 if match then
+                    host.debug("Distribution matches os-release.", { distribution = distribution, matched_by = matched_by, version_id = version_id })
                     local version = Version:new(version_id)
 
                     if version == nil then
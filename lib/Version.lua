@@ -48,8 +48,13 @@ function Version:__tostring()
     return self:concat(".")
 end
 
+function Version:__tojson()
+    return self:concat(".")
+end
+
 function Version:concat(sep)
-    return table.concat(self, sep)
+    -- table.concat returns the number itself if there is only one.
+    return tostring(table.concat(self, sep))
 end
 
 function Version.cmp(a, b)
@@ -0,0 +1,131 @@
+local host = require("host")
+
+local checksum = {}
+
+local function is_strict()
+    local v = os.getenv("MONGOD_STRICT_CHECKSUMS")
+    return v == "1" or v == "true" or v == "yes"
+end
+
+-- Returns the strongest checksum which is known for the given version (see
+-- versions.get()) as algorithm (sha256 or sha1) and its expected value. Older
+-- versions inside full.json only have a sha1. If there is no checksum at all,
+-- nil is returned; or an error is raised if MONGOD_STRICT_CHECKSUMS is set.
+function checksum.of(version)
+    if type(version.sha256) == "string" and version.sha256 ~= "" then
+        return "sha256", version.sha256:lower()
+    end
+    if type(version.sha1) == "string" and version.sha1 ~= "" then
+        return "sha1", version.sha1:lower()
+    end
+
+    if is_strict() then
+        error(("There is neither a sha256 nor a sha1 checksum available for %s@%s; refusing to install it because MONGOD_STRICT_CHECKSUMS is set."):format(tostring(version.url), tostring(version.version)))
+    end
+    host.warn(("There is no checksum available for %s@%s; it cannot be verified."):format(tostring(version.url), tostring(version.version)))
+    return nil
+end
+
+-- Calculates the checksum of the given file with the given algorithm (sha256
+-- or sha1) using the tools of the operating system.
+function checksum.file(path, algorithm)
+    local bits
+    if algorithm == "sha256" then
+        bits = "256"
+    elseif algorithm == "sha1" then
+        bits = "1"
+    else
+        error("Unsupported checksum algorithm: " .. tostring(algorithm))
+    end
+
+    local output
+    local plain = RUNTIME.osType:lower()
+    if plain == "windows" then
+        output = host.exec(([[powershell -NoProfile -Command "(Get-FileHash -Algorithm SHA%s -LiteralPath '%s').Hash"]]):format(bits, (path:gsub("'", "''"))))
+    elseif plain == "darwin" then
+        output = host.exec(("shasum -a %s '%s'"):format(bits, (path:gsub("'", "'\\''"))))
+    else
+        output = host.exec(("sha%ssum '%s'"):format(bits, (path:gsub("'", "'\\''"))))
+    end
+
+    local result = output:match("^%s*(%x+)")
+    if not result then
+        error(("Cannot calculate the %s checksum of %s: unexpected output: %s"):format(algorithm, path, output))
+    end
+    return result:lower()
+end
+
+-- Verifies the given file against the given algorithm (sha256 or sha1) and
+-- expected checksum and raises an error if it does not match.
+function checksum.verify_with(path, algorithm, expected)
+    local actual = checksum.file(path, algorithm)
+    if actual ~= expected then
+        error(("Checksum mismatch of %s: expected %s %s, but got %s."):format(path, algorithm, expected, actual))
+    end
+end
+
+-- Verifies the given file against the strongest checksum of the given
+-- version (see checksum.of()) and raises an error if it does not match.
+function checksum.verify(path, version)
+    local algorithm, expected = checksum.of(version)
+    if not algorithm then
+        return
+    end
+    checksum.verify_with(path, algorithm, expected)
+end
+
+local function remembered_file_name(archive_name)
+    return host.path_join(host.cache_dir(), archive_name .. ".checksum")
+end
+
+-- Remembers the given algorithm and expected checksum of the archive with
+-- the given name (like mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz) inside the
+-- cache directory, so PostInstall can verify the archive without resolving
+-- its version again (see checksum.remembered()).
+function checksum.remember(archive_name, algorithm, expected)
+    local fn = remembered_file_name(archive_name)
+    if not algorithm then
+        os.remove(fn)
+        return
+    end
+
+    local f, err = io.open(fn, "w")
+    if not f then
+        error("Cannot open " .. fn .. " for storing the checksum inside: " .. tostring(err))
+    end
+    f:write(algorithm .. " " .. expected .. "\n")
+    f:close()
+end
+
+-- Returns the algorithm and expected checksum which were remembered for the
+-- archive with the given name (see checksum.remember()) or nil if there are
+-- none.
+function checksum.remembered(archive_name)
+    local content = host.read_file(remembered_file_name(archive_name))
+    if not content then
+        return nil
+    end
+    local algorithm, expected = content:match("^(sha%d+) (%x+)")
+    if not algorithm then
+        return nil
+    end
+    return algorithm, expected:lower()
+end
+
+-- Verifies the archive with the given path against its remembered checksum
+-- (see checksum.remembered()). If there is none, only a warning is logged;
+-- or an error is raised if MONGOD_STRICT_CHECKSUMS is set.
+function checksum.verify_remembered(path)
+    local archive_name = path:match("([^/\\]+)$")
+    local algorithm, expected = checksum.remembered(archive_name)
+    if not algorithm then
+        if is_strict() then
+            error(("There is no known checksum of %s; refusing to install it because MONGOD_STRICT_CHECKSUMS is set."):format(path))
+        end
+        host.warn(("There is no known checksum of %s; it cannot be verified."):format(path))
+        return
+    end
+    checksum.verify_with(path, algorithm, expected)
+end
+
+return checksum
@@ -0,0 +1,209 @@
+local http = require("http")
+local json = require("json")
+local host = require("host")
+local Target = require("Target")
+local checksum = require("checksum")
+
+-- Companions are the binaries which are not part of the server archive but
+-- are installed next to it on request: mongosh (MongoDB 6+ no longer ships a
+-- shell) and the database tools (mongodump, mongorestore, ...).
+local companions = {}
+
+local shell_arches = {
+    x86_64 = "x64",
+    aarch64 = "arm64",
+    arm64 = "arm64",
+    s390x = "s390x",
+    ppc64le = "ppc64le",
+}
+
+local shell_distros = {
+    windows = "win32",
+    macos = "darwin",
+    linux = "linux",
+}
+
+-- mongosh is published for operating systems instead of targets, together
+-- with packages (like .deb, .rpm and .msi) which cannot simply be extracted.
+local function select_shell_download(downloads)
+    local arch, distro = shell_arches[host.arch()], shell_distros[Target.host().os]
+    for _, download in ipairs(downloads) do
+        local archive = download.archive
+        if download.arch == arch and download.distro == distro and type(archive) == "table" and archive.url and (archive.type == "tgz" or archive.type == "zip") then
+            return download
+        end
+    end
+    return nil
+end
+
+-- The database tools are published for the same targets as the server.
+local function select_tools_download(downloads)
+    local arch = host.arch()
+    local candidates = {}
+    for _, download in ipairs(downloads) do
+        if download.arch == arch and type(download.archive) == "table" and download.archive.url then
+            table.insert(candidates, download)
+        end
+    end
+    return Target.host():best_of(candidates, function(d)
+        return d.name
+    end)
+end
+
+companions.__definitions = {
+    {
+        name = "mongosh",
+        env = "MONGOD_WITH_SHELL",
+        feed = "https://downloads.mongodb.com/compass/mongosh.json",
+        feed_env = "MONGOD_SHELL_VERSIONS_URL",
+        executables = { "mongosh" },
+        select = select_shell_download,
+    },
+    {
+        name = "database-tools",
+        env = "MONGOD_WITH_TOOLS",
+        feed = "https://downloads.mongodb.org/tools/db/full.json",
+        feed_env = "MONGOD_TOOLS_VERSIONS_URL",
+        executables = { "mongodump", "mongorestore" },
+        select = select_tools_download,
+    },
+}
+
+-- Returns the version of the given companion which was requested by its
+-- environment variable: nil if not requested at all, "latest" for 1 (or true
+-- or yes) and otherwise the value itself as an exact version.
+local function requested_version(definition)
+    local v = os.getenv(definition.env)
+    if not v or v == "" or v == "0" or v == "false" or v == "no" then
+        return nil
+    end
+    if v == "1" or v == "true" or v == "yes" then
+        return "latest"
+    end
+    return v
+end
+
+-- Returns the url of the list of all versions of the given companion; its
+-- feed_env (like MONGOD_VERSIONS_URL for the server) can point to a mirror.
+local function feed_url(definition)
+    local explicit = os.getenv(definition.feed_env)
+    if explicit and explicit ~= "" then
+        return explicit
+    end
+    return definition.feed
+end
+
+-- Resolves the download of the given companion (see
+-- companions.__definitions) in the given version ("latest" for the newest
+-- release) for the current host.
+function companions.__resolve(definition, version)
+    local versions = require("versions")
+
+    local url = feed_url(definition)
+    local resp, err = http.get({
+        url = url,
+    })
+    if err ~= nil then
+        error(("Failed to fetch %s versions: %s"):format(definition.name, err))
+    end
+    if resp.status_code ~= 200 then
+        error(("Failed to fetch %s versions: %s returned status %d"):format(definition.name, url, resp.status_code))
+    end
+
+    local body, dErr = json.decode(resp.body)
+    if type(body) ~= "table" or type(body.versions) ~= "table" then
+        error(("Failed to parse %s versions: %s"):format(definition.name, tostring(dErr or "does not contain a list of versions")))
+    end
+
+    local result
+    for _, candidate in ipairs(body.versions) do
+        local matches
+        if version == "latest" then
+            matches = type(candidate.version) == "string" and not candidate.version:find("-", 1, true) and (not result or versions.__cmp(candidate.version, result.version) > 0)
+        else
+            matches = candidate.version == version
+        end
+
+        local download = matches and definition.select(candidate.downloads or {})
+        if download then
+            result = {
+                name = definition.name,
+                version = candidate.version,
+                url = versions.__mirror(download.archive.url),
+                sha256 = download.archive.sha256,
+                sha1 = download.archive.sha1,
+                executables = definition.executables,
+            }
+        end
+    end
+
+    if not result then
+        error(("Version %s of %s does not exist for %s/%s"):format(version, definition.name, Target.host_string(), host.arch()))
+    end
+    return result
+end
+
+-- Resolves the downloads of all requested companions.
+function companions.requested()
+    local result = {}
+    for _, definition in ipairs(companions.__definitions) do
+        local version = requested_version(definition)
+        if version then
+            table.insert(result, companions.__resolve(definition, version))
+        end
+    end
+    return result
+end
+
+-- Downloads, verifies and extracts all requested companions into a directory
+-- (named like the companion) inside the given installation path.
+function companions.install(path)
+    for _, companion in ipairs(companions.requested()) do
+        -- The archiver of MISE only knows .tar.gz, not .tgz
+        local archive_name = companion.url:match("([^/\\]+)$"):gsub("%.tgz$", ".tar.gz")
+        local archive = host.path_join(path, archive_name)
+
+        local err = http.download_file({
+            url = companion.url,
+        }, archive)
+        if err then
+            host.rm(archive)
+            error(("Failed to download %s: %s"):format(companion.name, err))
+        end
+        -- Never leave a tampered or corrupt archive behind.
+        local vOk, vErr = pcall(checksum.verify, archive, companion)
+        if not vOk then
+            host.rm(archive)
+            error(vErr, 0)
+        end
+
+        -- All archives contain a single directory named like the archive itself.
+        host.extract(archive, path)
+        host.rm(archive)
+        local target = host.path_join(path, companion.name)
+        host.rm(target)
+        host.mv(host.path_join(path, (archive_name:gsub("%.tar%.gz$", ""):gsub("%.zip$", ""))), target)
+
+        for _, executable in ipairs(companion.executables) do
+            local exe = host.path_join(target, "bin", host.with_exec_ext(executable))
+            if not host.can_read(exe) then
+                error(("%s@%s installation appears to be broken: %s does not exist"):format(companion.name, companion.version, exe))
+            end
+        end
+    end
+end
+
+-- Returns the bin directories of all companions which are installed inside
+-- the given installation path.
+function companions.bin_dirs(path)
+    local result = {}
+    for _, definition in ipairs(companions.__definitions) do
+        local bin = host.path_join(path, definition.name, "bin")
+        if host.can_read(host.path_join(bin, host.with_exec_ext(definition.executables[1]))) then
+            table.insert(result, bin)
+        end
+    end
+    return result
+end
+
+return companions
@@ -25,6 +25,15 @@ function host.read_file(path)
     return content, nil
 end
 
+function host.write_file(path, content)
+    local f, err = io.open(path, "w")
+    if not f then
+        error("Cannot open " .. path .. " for writing: " .. tostring(err))
+    end
+    f:write(content)
+    f:close()
+end
+
 function host.can_read(path)
     local f = io.open(path, "r")
     if not f then
@@ -80,6 +89,57 @@ function host.exec(command)
     end
 end
 
+-- Returns the log module if the runtime provides one, otherwise nil.
+local function log_module()
+    local rlOk, log = pcall(require, "log")
+    if rlOk and type(log) == "table" then
+        return log
+    end
+    return nil
+end
+
+-- Reports the given message as warning; through the log module if the
+-- runtime provides one, otherwise to stderr.
+function host.warn(message)
+    local log = log_module()
+    if log and log.warn then
+        log.warn(tostring(message))
+        return
+    end
+    io.stderr:write("[mongod] WARNING: " .. tostring(message) .. "\n")
+end
+
+function host.is_debug()
+    local v = os.getenv("MONGOD_DEBUG")
+    return v == "1" or v == "true" or v == "yes"
+end
+
+-- Reports the given message (with the optional table of fields) if
+-- MONGOD_DEBUG is set; through the log module if the runtime provides one,
+-- otherwise to stderr.
+function host.debug(message, fields)
+    if not host.is_debug() then
+        return
+    end
+
+    local log = log_module()
+    if log and log.debug then
+        log.debug(message, fields)
+        return
+    end
+
+    local keys = {}
+    for key in pairs(fields or {}) do
+        table.insert(keys, key)
+    end
+    table.sort(keys)
+    local line = "[mongod] DEBUG: " .. tostring(message)
+    for _, key in ipairs(keys) do
+        line = line .. " " .. key .. "=" .. tostring(fields[key])
+    end
+    io.stderr:write(line .. "\n")
+end
+
 function host.mkdirs(name)
     if RUNTIME.osType:lower() == "windows" then
         host.exec(string.format([[powershell -NoProfile -Command ^New-Item -ItemType Directory -Force -Path '%s'^]], name))
@@ -110,6 +170,112 @@ function host.rm(name)
     return name
 end
 
+-- Returns the names of all entries of the given directory (or an empty table
+-- if it does not exist). Every other failure, like missing permissions, is
+-- raised.
+function host.list_dir(name)
+    local output
+    if RUNTIME.osType:lower() == "windows" then
+        local quoted = name:gsub("'", "''")
+        output = host.exec(string.format([[powershell -NoProfile -Command "if (Test-Path -LiteralPath '%s' -PathType Container) { Get-ChildItem -Name -Force -LiteralPath '%s' }"]], quoted, quoted))
+    else
+        local quoted = name:gsub("'", "'\\''")
+        output = host.exec(string.format("if [ -d '%s' ]; then ls -1A '%s'; fi", quoted, quoted))
+    end
+    local result = {}
+    for line in output:gmatch("[^\r\n]+") do
+        table.insert(result, line)
+    end
+    return result
+end
+
+-- Shell functions which every helper script (see host.install_helper) gets
+-- for its @SHELL_FUNCTIONS@.
+host.__shell_functions = [[
+# Prints the pid of the given pid file if its process is running.
+running_pid() {
+    if [ -f "$1" ]; then
+        pid="$(cat "$1")"
+        if [ -n "$pid" ] && kill -0 "$pid" 2>/dev/null; then
+            echo "$pid"
+            return 0
+        fi
+    fi
+    return 1
+}
+
+# Escapes the given value for a double quoted YAML (or JavaScript) string.
+escape_string() {
+    printf '%s\n' "$1" | sed -e 's/[\\"]/\\&/g'
+}
+
+# Escapes the given value for a double quoted YAML string and then for the
+# replacement of sed (which uses | as delimiter).
+escape() {
+    escape_string "$1" | sed -e 's/[\\|&]/\\&/g'
+}
+]]
+
+-- Installs the helper script of the given name (inside the bin directory, so
+-- it is available on the PATH) together with the given files (by their path
+-- relative to the installation) into the given installation path. The
+-- @VERSION@ of all of them is replaced by the given version.
+function host.install_helper(path, name, version, script, files)
+    -- The helper scripts are shell scripts; Windows is currently not supported.
+    if RUNTIME.osType:lower() == "windows" then
+        return
+    end
+
+    local function render(s)
+        return (s:gsub("@VERSION@", version))
+    end
+
+    for fn, content in pairs(files or {}) do
+        fn = host.path_join(path, fn)
+        host.mkdirs((fn:match("^(.*)[/\\]")))
+        host.write_file(fn, render(content))
+    end
+
+    local fn = host.path_join(host.mkdirs(host.path_join(path, "bin")), name)
+    host.write_file(fn, (render(script):gsub("@SHELL_FUNCTIONS@\n", function()
+        return host.__shell_functions
+    end)))
+    host.exec(string.format("chmod +x '%s'", (fn:gsub("'", "'\\''"))))
+end
+
+-- Quotes the given argument for a command line of Windows like
+-- CommandLineToArgvW expects it: quotes are escaped with a backslash and
+-- backslashes are only doubled in front of a quote.
+local function quote_windows_argument(s)
+    s = s:gsub('(\\*)"', function(backslashes)
+        return backslashes .. backslashes .. '\\"'
+    end)
+    s = s:gsub("(\\+)$", "%1%1")
+    return '"' .. s .. '"'
+end
+
+-- Extracts the given archive (.tar.gz or .zip) into the given destination;
+-- with the archiver of MISE if available, otherwise with tar (which is also
+-- shipped with Windows and can extract .zip there, too).
+function host.extract(archive, destination)
+    local raOk, archiver = pcall(require, "archiver")
+    if raOk then
+        local err = archiver.decompress(archive, destination)
+        if err then
+            error(string.format("Cannot extract %s: %s", archive, tostring(err)))
+        end
+        return destination
+    end
+
+    if RUNTIME.osType:lower() == "windows" then
+        host.exec(string.format([[tar -xf %s -C %s]], quote_windows_argument(archive), quote_windows_argument(destination)))
+        return destination
+    end
+
+    host.exec(string.format("tar -xf '%s' -C '%s'", (archive:gsub("'", "'\\''")), (destination:gsub("'", "'\\''"))))
+    return destination
+end
+
 function mise_cache_dir()
     local explicit = os.getenv("MISE_CACHE_DIR")
     if explicit then
@@ -216,4 +382,18 @@ function host.arch()
     error("Unsupported architecture: " .. plain)
 end
 
+function host.edition()
+    local plain = os.getenv("MONGOD_EDITION")
+    if not plain or plain == "" then
+        return "community"
+    end
+
+    plain = plain:lower()
+    if plain == "community" or plain == "enterprise" then
+        return plain
+    end
+
+    error("Unsupported edition: " .. plain)
+end
+
 return host
@@ -0,0 +1,139 @@
+local host = require("host")
+
+-- A managed instance is a local mongod for development, which keeps its data
+-- inside the .mise directory of the current project. For this, every
+-- installation contains a mongod.conf template and the mongod-instance helper
+-- script (inside its bin directory, so it is available on the PATH) which
+-- starts, stops and reports the status of this instance.
+local instance = {}
+
+instance.__template = [[
+# Generated by vfox-mongod for mongod @VERSION@.
+# All @...@ placeholders are replaced by mongod-instance on start.
+storage:
+  dbPath: "@DBPATH@"
+systemLog:
+  destination: file
+  path: "@LOGPATH@"
+  logAppend: true
+net:
+  bindIp: "@BIND_IP@"
+  port: @PORT@
+]]
+
+instance.__script = [[
+#!/bin/sh
+# Generated by vfox-mongod for mongod @VERSION@.
+#
+# Usage: mongod-instance start|stop|status
+#
+# Manages a local mongod which keeps its data inside
+# ${MONGOD_INSTANCE_DIR:-${MISE_PROJECT_ROOT:-$PWD}/.mise/mongod} and listens
+# on ${MONGOD_BIND_IP:-127.0.0.1}:${MONGOD_PORT:-27017}. start waits up to
+# ${MONGOD_START_TIMEOUT:-30} seconds until mongod accepts connections.
+
+set -e
+
+home="$(cd "$(dirname "$0")/.." && pwd)"
+dir="${MONGOD_INSTANCE_DIR:-${MISE_PROJECT_ROOT:-$PWD}/.mise/mongod}"
+port="${MONGOD_PORT:-27017}"
+bind_ip="${MONGOD_BIND_IP:-127.0.0.1}"
+start_timeout="${MONGOD_START_TIMEOUT:-30}"
+pid_file="$dir/mongod.pid"
+log_file="$dir/mongod.log"
+
+@SHELL_FUNCTIONS@
+# Prints the end of the log (and of the output) of mongod to stderr.
+log_tail() {
+    for f in "$log_file" "$dir/mongod.out"; do
+        if [ -s "$f" ]; then
+            printf '%s\n' "--- $f" >&2
+            tail -n 20 "$f" >&2
+        fi
+    done
+}
+
+case "$1" in
+start)
+    if pid="$(running_pid "$pid_file")"; then
+        echo "mongod is already running (pid $pid)."
+        exit 0
+    fi
+    mkdir -p "$dir/data"
+    sed \
+        -e "s|@DBPATH@|$(escape "$dir/data")|g" \
+        -e "s|@LOGPATH@|$(escape "$log_file")|g" \
+        -e "s|@BIND_IP@|$(escape "$bind_ip")|g" \
+        -e "s|@PORT@|$(escape "$port")|g" \
+        "$home/instance/mongod.conf.template" > "$dir/mongod.conf"
+    # The log is appended to; only what this start adds counts.
+    log_offset=0
+    if [ -f "$log_file" ]; then
+        log_offset="$(wc -c < "$log_file")"
+    fi
+    nohup "$home/bin/mongod" --config "$dir/mongod.conf" > "$dir/mongod.out" 2>&1 &
+    pid="$!"
+    echo "$pid" > "$pid_file"
+    i=0
+    until tail -c +"$((log_offset + 1))" "$log_file" 2>/dev/null | grep -qi "waiting for connections"; do
+        if ! kill -0 "$pid" 2>/dev/null; then
+            rm -f "$pid_file"
+            echo "mongod (pid $pid) exited during start." >&2
+            log_tail
+            exit 1
+        fi
+        i=$((i + 1))
+        if [ "$i" -gt "$start_timeout" ]; then
+            kill "$pid" 2>/dev/null || true
+            rm -f "$pid_file"
+            echo "mongod (pid $pid) did not accept connections within $start_timeout seconds." >&2
+            log_tail
+            exit 1
+        fi
+        sleep 1
+    done
+    printf 'mongod started (pid %s, port %s, data %s).\n' "$pid" "$port" "$dir/data"
+    ;;
+stop)
+    if ! pid="$(running_pid "$pid_file")"; then
+        rm -f "$pid_file"
+        echo "mongod is not running."
+        exit 0
+    fi
+    kill "$pid"
+    i=0
+    while kill -0 "$pid" 2>/dev/null; do
+        i=$((i + 1))
+        if [ "$i" -gt 10 ]; then
+            echo "mongod (pid $pid) did not stop within 10 seconds." >&2
+            exit 1
+        fi
+        sleep 1
+    done
+    rm -f "$pid_file"
+    echo "mongod stopped (pid $pid)."
+    ;;
+status)
+    if pid="$(running_pid "$pid_file")"; then
+        printf 'mongod is running (pid %s, port %s, data %s).\n' "$pid" "$port" "$dir/data"
+        exit 0
+    fi
+    echo "mongod is not running."
+    exit 3
+    ;;
+*)
+    echo "Usage: $(basename "$0") start|stop|status" >&2
+    exit 2
+    ;;
+esac
+]]
+
+-- Generates the mongod.conf template and the mongod-instance helper script
+-- for the given version inside the given installation path.
+function instance.install(path, version)
+    host.install_helper(path, "mongod-instance", version, instance.__script, {
+        [host.path_join("instance", "mongod.conf.template")] = instance.__template,
+    })
+end
+
+return instance
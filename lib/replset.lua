@@ -0,0 +1,362 @@
+local host = require("host")
+
+-- A local replica set is required for multi-document transactions, even in
+-- development. For this, every installation contains a mongod.conf template
+-- for its members and the mongod-replset helper script (inside its bin
+-- directory, so it is available on the PATH) which starts (and initiates with
+-- rs.initiate), stops and reports the status of the replica set requested by
+-- MONGOD_REPLSET_MEMBERS. Its connection string is exported on activation of
+-- the environment (see EnvKeys), which also starts it if
+-- MONGOD_REPLSET_AUTOSTART is set (see replset.start).
+--
+-- replset.config and the script share their defaults and validation; both
+-- also share the command lines below, so they always start the same replica
+-- set.
+local replset = {}
+
+local max_members = 7 -- The maximum of voting members
+
+-- By default, the members use the ports after the one of mongod-instance
+-- (see instance.lua), so both can be used together.
+local default_port = 27018
+
+replset.__template = [[
+# Generated by vfox-mongod for mongod @VERSION@.
+# All @...@ placeholders are replaced on start; the port and the name of the
+# replica set are passed as arguments.
+storage:
+  dbPath: "@DBPATH@"
+systemLog:
+  destination: file
+  path: "@LOGPATH@"
+  logAppend: true
+processManagement:
+  fork: true
+  pidFilePath: "@PIDPATH@"
+net:
+  bindIp: "@BIND_IP@"
+security:
+  keyFile: "@KEYFILE@"
+  transitionToAuth: true
+]]
+
+replset.__script = [[
+#!/bin/sh
+# Generated by vfox-mongod for mongod @VERSION@.
+#
+# Usage: mongod-replset start|stop|status|uri
+#
+# Manages a local replica set with ${MONGOD_REPLSET_MEMBERS} (1 to 7) members
+# named ${MONGOD_REPLSET_NAME:-rs0}, which keeps its data inside
+# ${MONGOD_REPLSET_DIR:-${MISE_PROJECT_ROOT:-$PWD}/.mise/mongod-replset}. The
+# members listen on ${MONGOD_BIND_IP:-127.0.0.1} with the ports from
+# ${MONGOD_REPLSET_PORT:-27018} on and are advertised to clients (and each
+# other) as ${MONGOD_REPLSET_HOST:-127.0.0.1}. start initiates the replica set
+# with mongosh (see MONGOD_WITH_SHELL); uri prints its connection string.
+
+set -e
+
+@SHELL_FUNCTIONS@
+
+# Prints the given decimal number without leading zeros (which $((...))
+# would read as octal) or fails if it is none.
+decimal() {
+    case "$1" in
+    '' | *[!0-9]*) return 1 ;;
+    esac
+    set -- "${1#"${1%%[!0]*}"}"
+    echo "${1:-0}"
+}
+
+home="$(cd "$(dirname "$0")/.." && pwd)"
+name="${MONGOD_REPLSET_NAME:-rs0}"
+bind_ip="${MONGOD_BIND_IP:-127.0.0.1}"
+advertised_host="${MONGOD_REPLSET_HOST:-127.0.0.1}"
+dir="${MONGOD_REPLSET_DIR:-${MISE_PROJECT_ROOT:-$PWD}/.mise/mongod-replset}"
+keyfile="$dir/keyfile"
+
+if ! members="$(decimal "${MONGOD_REPLSET_MEMBERS:-}")" || [ "$members" -lt 1 ] || [ "$members" -gt 7 ]; then
+    printf '%s\n' "MONGOD_REPLSET_MEMBERS must be a number between 1 and 7, but is ${MONGOD_REPLSET_MEMBERS:-}." >&2
+    exit 2
+fi
+if ! port="$(decimal "${MONGOD_REPLSET_PORT:-27018}")"; then
+    printf '%s\n' "MONGOD_REPLSET_PORT must be a number, but is $MONGOD_REPLSET_PORT." >&2
+    exit 2
+fi
+
+# The members authenticate each other with this key file, which has to be
+# the same for all of them (and only readable by its owner).
+ensure_keyfile() {
+    if [ -s "$keyfile" ]; then
+        return 0
+    fi
+    @KEYFILE_COMMAND@
+    if [ "$(wc -c < "$keyfile.tmp")" -ne 756 ]; then
+        rm -f "$keyfile.tmp"
+        echo "Cannot generate the key file of the replica set: neither openssl nor /dev/urandom with base64 are available." >&2
+        exit 1
+    fi
+    chmod 600 "$keyfile.tmp"
+    mv "$keyfile.tmp" "$keyfile"
+}
+
+case "$1" in
+start)
+    mkdir -p "$dir"
+    ensure_keyfile
+    started=0
+    hosts=""
+    i=1
+    while [ "$i" -le "$members" ]; do
+        member="$dir/member$i"
+        member_port=$((port + i - 1))
+        hosts="$hosts${hosts:+, }{_id: $((i - 1)), host: \"$(escape_string "$advertised_host"):$member_port\"}"
+        if ! running_pid "$member/mongod.pid" > /dev/null; then
+            mkdir -p "$member/data"
+            sed \
+                -e "s|@DBPATH@|$(escape "$member/data")|g" \
+                -e "s|@LOGPATH@|$(escape "$member/mongod.log")|g" \
+                -e "s|@PIDPATH@|$(escape "$member/mongod.pid")|g" \
+                -e "s|@BIND_IP@|$(escape "$bind_ip")|g" \
+                -e "s|@KEYFILE@|$(escape "$keyfile")|g" \
+                "$home/replset/mongod.conf.template" > "$member/mongod.conf"
+            # With fork, mongod returns once the member is ready or has failed.
+            if ! @MONGOD_COMMAND@ > "$member/mongod.out" 2>&1; then
+                echo "Member $i of the replica set $name did not start." >&2
+                tail -n 20 "$member/mongod.out" "$member/mongod.log" >&2 2>/dev/null || true
+                exit 1
+            fi
+            started=1
+        fi
+        i=$((i + 1))
+    done
+    if [ "$started" = 1 ]; then
+        shell="$home/mongosh/bin/mongosh"
+        if [ ! -x "$shell" ]; then
+            shell="mongosh"
+        fi
+        eval="try { rs.status() } catch (e) { rs.initiate({_id: \"$(escape_string "$name")\", members: [$hosts]}) }"
+        if ! @MONGOSH_COMMAND@; then
+            echo "Cannot initiate the replica set $name (mongosh is required, see MONGOD_WITH_SHELL)." >&2
+            exit 1
+        fi
+    fi
+    printf '%s\n' "Replica set $name is running ($members members, ports $port to $((port + members - 1)), data $dir)."
+    ;;
+stop)
+    i=1
+    while [ "$i" -le "$members" ]; do
+        member="$dir/member$i"
+        if pid="$(running_pid "$member/mongod.pid")"; then
+            kill "$pid"
+            j=0
+            while kill -0 "$pid" 2>/dev/null; do
+                j=$((j + 1))
+                if [ "$j" -gt 10 ]; then
+                    echo "Member $i (pid $pid) did not stop within 10 seconds." >&2
+                    exit 1
+                fi
+                sleep 1
+            done
+            echo "Member $i stopped (pid $pid)."
+        fi
+        rm -f "$member/mongod.pid"
+        i=$((i + 1))
+    done
+    ;;
+status)
+    result=0
+    i=1
+    while [ "$i" -le "$members" ]; do
+        if pid="$(running_pid "$dir/member$i/mongod.pid")"; then
+            echo "Member $i is running (pid $pid, port $((port + i - 1)))."
+        else
+            echo "Member $i is not running."
+            result=3
+        fi
+        i=$((i + 1))
+    done
+    exit "$result"
+    ;;
+uri)
+    hosts=""
+    i=1
+    while [ "$i" -le "$members" ]; do
+        hosts="$hosts${hosts:+,}$advertised_host:$((port + i - 1))"
+        i=$((i + 1))
+    done
+    printf '%s\n' "mongodb://$hosts/?replicaSet=$name"
+    ;;
+*)
+    echo "Usage: $(basename "$0") start|stop|status|uri" >&2
+    exit 2
+    ;;
+esac
+]]
+
+-- Returns the command line which writes a new key file (756 base64
+-- characters) to the given (already quoted) file.
+function replset.__keyfile_command(fn)
+    return "(umask 077 && { openssl rand -base64 567 2>/dev/null || head -c 567 /dev/urandom | base64; } | tr -d '\\n' > " .. fn .. ")"
+end
+
+-- Returns the command line which starts a member with the given (already
+-- quoted) mongod, configuration, name of the replica set and port.
+function replset.__mongod_command(mongod, conf, name, port)
+    return ("%s --config %s --replSet %s --port %s"):format(mongod, conf, name, port)
+end
+
+-- Returns the command line which evaluates the given (already quoted)
+-- script with the given mongosh on the given host and port.
+function replset.__mongosh_command(mongosh, host_name, port, eval)
+    return ("%s --quiet --host %s --port %s --eval %s"):format(mongosh, host_name, port, eval)
+end
+
+local function quote(s)
+    return "'" .. tostring(s):gsub("'", "'\\''") .. "'"
+end
+
+-- Escapes the given value for a double quoted YAML (or JavaScript) string.
+local function escape_string(s)
+    return (tostring(s):gsub('[\\"]', "\\%0"))
+end
+
+-- Returns the value of the given environment variable; like the script
+-- does, an empty one counts as unset.
+local function getenv(key)
+    local value = os.getenv(key)
+    if value == "" then
+        return nil
+    end
+    return value
+end
+
+-- Returns the configuration of the replica set from the environment (with
+-- the same defaults and validation as mongod-replset) or nil if no replica
+-- set was requested.
+function replset.config()
+    local members = getenv("MONGOD_REPLSET_MEMBERS")
+    if not members or members:match("^0+$") then
+        return nil
+    end
+    local n = members:match("^%d+$") and tonumber(members)
+    if not n or n < 1 or n > max_members then
+        error(("MONGOD_REPLSET_MEMBERS must be a number between 1 and %d, but is %s."):format(max_members, members))
+    end
+
+    local port = getenv("MONGOD_REPLSET_PORT") or tostring(default_port)
+    if not port:match("^%d+$") then
+        error(("MONGOD_REPLSET_PORT must be a number, but is %s."):format(port))
+    end
+
+    return {
+        name = getenv("MONGOD_REPLSET_NAME") or "rs0",
+        members = n,
+        port = tonumber(port),
+        host = getenv("MONGOD_REPLSET_HOST") or "127.0.0.1",
+        bind_ip = getenv("MONGOD_BIND_IP") or "127.0.0.1",
+        dir = getenv("MONGOD_REPLSET_DIR") or host.path_join(getenv("MISE_PROJECT_ROOT") or getenv("PWD") or ".", ".mise", "mongod-replset"),
+    }
+end
+
+-- Returns the connection string of the given replica set.
+function replset.uri(config)
+    local hosts = {}
+    for i = 1, config.members do
+        table.insert(hosts, config.host .. ":" .. (config.port + i - 1))
+    end
+    return ("mongodb://%s/?replicaSet=%s"):format(table.concat(hosts, ","), config.name)
+end
+
+-- Returns the script which initiates the given replica set, unless it is
+-- already initiated.
+function replset.__initiate_script(config)
+    local members = {}
+    for i = 1, config.members do
+        table.insert(members, ('{_id: %d, host: "%s:%d"}'):format(i - 1, escape_string(config.host), config.port + i - 1))
+    end
+    return ('try { rs.status() } catch (e) { rs.initiate({_id: "%s", members: [%s]}) }'):format(escape_string(config.name), table.concat(members, ", "))
+end
+
+-- Returns the pid of the given pid file if its process is running.
+local function running_pid(pid_file)
+    local pid = (host.read_file(pid_file) or ""):match("^%s*(%d+)")
+    if pid and pcall(host.exec, "kill -0 " .. pid) then
+        return pid
+    end
+    return nil
+end
+
+local function ensure_keyfile(config)
+    local fn = host.path_join(config.dir, "keyfile")
+    if host.can_read(fn) then
+        return fn
+    end
+    host.exec(replset.__keyfile_command(quote(fn .. ".tmp")))
+    if #(host.read_file(fn .. ".tmp") or "") ~= 756 then
+        os.remove(fn .. ".tmp")
+        error("Cannot generate the key file of the replica set: neither openssl nor /dev/urandom with base64 are available.")
+    end
+    host.exec(("chmod 600 %s && mv %s %s"):format(quote(fn .. ".tmp"), quote(fn .. ".tmp"), quote(fn)))
+    return fn
+end
+
+-- Starts the members of the given replica set which are not running yet
+-- with the mongod of the given installation and initiates the replica set
+-- afterward, like mongod-replset start does.
+function replset.start(path, config)
+    if RUNTIME.osType:lower() == "windows" then
+        error("The replica set is currently not supported on Windows.")
+    end
+    local template, err = host.read_file(host.path_join(path, "replset", "mongod.conf.template"))
+    if not template then
+        error(err)
+    end
+
+    host.mkdirs(config.dir)
+    local keyfile = ensure_keyfile(config)
+    local started = false
+    for i = 1, config.members do
+        local member = host.path_join(config.dir, "member" .. i)
+        local pid_file = host.path_join(member, "mongod.pid")
+        if not running_pid(pid_file) then
+            local values = {
+                DBPATH = host.path_join(member, "data"),
+                LOGPATH = host.path_join(member, "mongod.log"),
+                PIDPATH = pid_file,
+                BIND_IP = config.bind_ip,
+                KEYFILE = keyfile,
+            }
+            host.mkdirs(values.DBPATH)
+            local conf = host.path_join(member, "mongod.conf")
+            host.write_file(conf, (template:gsub("@([%u_]+)@", function(key)
+                return values[key] and escape_string(values[key])
+            end)))
+            host.exec(replset.__mongod_command(quote(host.path_join(path, "bin", "mongod")), quote(conf), quote(config.name), config.port + i - 1))
+            started = true
+        end
+    end
+
+    if started then
+        local shell = host.path_join(path, "mongosh", "bin", "mongosh")
+        if not host.can_read(shell) then
+            shell = "mongosh"
+        end
+        host.exec(replset.__mongosh_command(quote(shell), quote(config.host), config.port, quote(replset.__initiate_script(config))))
+    end
+end
+
+-- Generates the mongod.conf template and the mongod-replset helper script
+-- for the given version inside the given installation path.
+function replset.install(path, version)
+    local commands = {
+        KEYFILE_COMMAND = replset.__keyfile_command('"$keyfile.tmp"'),
+        MONGOD_COMMAND = replset.__mongod_command('"$home/bin/mongod"', '"$member/mongod.conf"', '"$name"', '"$member_port"'),
+        MONGOSH_COMMAND = replset.__mongosh_command('"$shell"', '"$advertised_host"', '"$port"', '"$eval"'),
+    }
+    host.install_helper(path, "mongod-replset", version, (replset.__script:gsub("@([%u_]+_COMMAND)@", commands)), {
+        [host.path_join("replset", "mongod.conf.template")] = replset.__template,
+    })
+end
+
+return replset
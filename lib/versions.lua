@@ -3,28 +3,119 @@ local json = require("json")
 local Semver = require("Semver")
 local host = require("host")
 local Target = require("Target")
-local Version = require("Version")
 
 local versions = {}
 
-local cache_ttl = 24 * 60 * 60 -- 12 hours
+local default_cache_ttl = 24 * 60 * 60 -- 24 hours
 
-function versions.__fetch()
+local duration_units = {
+    s = 1,
+    m = 60,
+    h = 60 * 60,
+    d = 24 * 60 * 60,
+}
+
+-- Increase this whenever the structure of the cached versions changes.
+local cache_format = 2
+
+local default_versions_url = "https://downloads.mongodb.org/full.json"
+
+-- Returns the url of the feed of all versions, which can be replaced by a
+-- mirror with MONGOD_VERSIONS_URL.
+function versions.__url()
+    local explicit = os.getenv("MONGOD_VERSIONS_URL")
+    if explicit and explicit ~= "" then
+        return explicit
+    end
+    return default_versions_url
+end
+
+-- Rewrites the given download url to the mirror of MONGOD_DOWNLOAD_BASE_URL
+-- (if set), by replacing its scheme and host; the path is kept. As the
+-- archives are expected to be the same, the checksums stay valid.
+function versions.__mirror(url)
+    local base = os.getenv("MONGOD_DOWNLOAD_BASE_URL")
+    if not base or base == "" or type(url) ~= "string" then
+        return url
+    end
+    local path = url:match("^%a[%w+.-]*://[^/]*(/.*)$") or ""
+    return base:gsub("/+$", "") .. path
+end
+
+local function abbreviate(s, max)
+    s = tostring(s)
+    if #s > max then
+        return s:sub(1, max) .. "..."
+    end
+    return s
+end
+
+-- Headers are matched case-insensitive, because the runtimes differ in the
+-- spelling of the header names they report.
+local function response_header(resp, name)
+    if type(resp.headers) ~= "table" then
+        return nil
+    end
+    name = name:lower()
+    for key, value in pairs(resp.headers) do
+        if type(key) == "string" and key:lower() == name then
+            return value
+        end
+    end
+    return nil
+end
+
+-- The community edition is published as base (generic builds, like for
+-- windows and macos) and targeted (builds for a specific distribution).
+local function is_edition(download, edition)
+    if edition == "enterprise" then
+        return download.edition == "enterprise"
+    end
+    return download.edition == "base" or download.edition == "targeted"
+end
+
+-- Fetches all versions. If validators (etag and/or last_modified of a
+-- previous fetch) are given, the request is conditional and nil is returned
+-- if nothing changed since then. Otherwise, the versions, the latest version
+-- and the validators of this response are returned.
+function versions.__fetch(validators)
+    local versions_url = versions.__url()
     local target = Target.host()
     local arch = host.arch()
+    local edition = host.edition()
+    local debug = host.is_debug()
+    host.debug("Fetching versions.", { url = versions_url, target = tostring(target), arch = arch, edition = edition })
+
+    local headers = {}
+    if validators and validators.etag then
+        headers["If-None-Match"] = validators.etag
+    end
+    if validators and validators.last_modified then
+        headers["If-Modified-Since"] = validators.last_modified
+    end
 
     local resp, err = http.get({
-        url = "https://downloads.mongodb.org/full.json",
+        url = versions_url,
+        headers = headers,
     })
 
     if err ~= nil then
         error("Failed to fetch versions: " .. err)
     end
+    if resp.status_code == 304 and next(headers) then
+        return nil
+    end
     if resp.status_code ~= 200 then
-        error("GitHub API returned status " .. resp.status_code .. ": " .. resp.body)
+        error(("Failed to fetch versions: %s returned status %d: %s"):format(versions_url, resp.status_code, abbreviate(resp.body, 200)))
     end
 
-    local body = json.decode(resp.body)
+    local body, dErr = json.decode(resp.body)
+    if type(body) ~= "table" then
+        error("Failed to parse versions: " .. tostring(dErr))
+    end
+    if type(body.versions) ~= "table" then
+        error(("Failed to parse versions: %s does not contain a list of versions"):format(versions_url))
+    end
 
     local latest
     local result = {}
@@ -41,90 +132,279 @@ function versions.__fetch()
             note = "latest"
         end
 
-        local candidate
-        for _, download in ipairs(version.downloads) do
-            if download.arch == arch then
-                if download.edition == "base" or download.edition == "targeted" then
-                    if download.archive and download.archive.url then
-                        local _, download_target = pcall(Target.new, Target, download.target)
-                        if target:equals(download_target) then
-                            candidate = {
-                                target_version = target.version,
-                                download = download
-                            }
-                        elseif target:equals_base(download_target) and download_target.version and Version.cmp(target.version, download_target.version) >= 0 then
-                            if not candidate or Version.cmp(download_target.version, candidate.target_version) > 0 then
-                                candidate = {
-                                    target_version = download_target.version,
-                                    download = download
-                                }
-                            end
-                        end
-                    end
+        local downloads = {}
+        for _, download in ipairs(version.downloads or {}) do
+            if download.arch == arch and is_edition(download, edition) and download.archive and download.archive.url then
+                table.insert(downloads, download)
+            elseif debug then
+                local reason
+                if download.arch ~= arch then
+                    reason = "Download rejected: other arch."
+                elseif not is_edition(download, edition) then
+                    reason = "Download rejected: other edition."
+                else
+                    reason = "Download rejected: without archive."
                 end
+                host.debug(reason, { version = version.version, target = download.target, arch = download.arch, edition = download.edition })
+            end
+        end
+        local download = target:best_of(downloads, function(d)
+            return d.target
+        end)
+        if debug then
+            if download then
+                host.debug("Download selected.", { version = version.version, target = download.target, url = download.archive.url })
+            else
+                host.debug("Version rejected: there is no download for the target.", { version = version.version, target = tostring(target) })
             end
         end
 
-        if candidate then
+        if download then
             local sv = Semver:new(version.version)
-            if version.production_release == true and sv and not latest or Semver.cmp(sv, latest) > 0 then
-                latest = sv
+            local release_candidate = version.release_candidate == true or (sv ~= nil and sv.prerelease ~= nil)
+            if version.production_release == true and sv and (not latest or versions.__cmp(version.version, latest) > 0) then
+                latest = version.version
             end
 
             result[version.version] = {
                 note = note,
+                production = version.production_release == true,
+                lts = version.lts_release == true,
+                release_candidate = release_candidate,
                 release_notes = version.notes,
-                edition = candidate.download.edition,
-                url = candidate.download.archive.url,
-                sha1 = candidate.download.archive.sha1,
-                sha256 = candidate.download.archive.sha256,
+                edition = download.edition,
+                url = download.archive.url,
+                sha1 = download.archive.sha1,
+                sha256 = download.archive.sha256,
             }
         end
     end
 
-    local latestStr
-    if latest then
-        latestStr = latest.string
+    return result, latest, {
+        etag = response_header(resp, "ETag"),
+        last_modified = response_header(resp, "Last-Modified"),
+    }
+end
+
+-- Parses durations like 90 (seconds), 30s, 15m, 12h, 7d or 1h30m into
+-- seconds. Returns nil if the given string is not a valid duration.
+function versions.__parse_duration(s)
+    s = s:match("^%s*(.-)%s*$")
+    if s:match("^%d+$") then
+        return tonumber(s)
     end
-    return result, latestStr
+    if s == "" then
+        return nil
+    end
+
+    local result = 0
+    while s ~= "" do
+        local n, unit, rest = s:match("^(%d+%.?%d*)(%a)(.*)$")
+        if not n or not duration_units[unit] then
+            return nil
+        end
+        result = result + tonumber(n) * duration_units[unit]
+        s = rest
+    end
+    return math.floor(result)
+end
+
+-- Returns how long (in seconds) the fetched versions are cached; can be
+-- changed with MONGOD_CACHE_TTL. With 0, the versions are fetched every time
+-- (but the cache is still kept as fallback).
+function versions.cache_ttl()
+    local plain = os.getenv("MONGOD_CACHE_TTL")
+    if not plain or plain == "" then
+        return default_cache_ttl
+    end
+    local result = versions.__parse_duration(plain)
+    if not result then
+        error(("MONGOD_CACHE_TTL must be a duration (like 12h, 30m or 0), but is %s."):format(plain))
+    end
+    return result
 end
 
 function cache_file_name()
-    return host.path_join(host.cache_dir(), "versions-" .. Target.host_string() .. "-" .. host.arch() .. ".json")
+    return host.path_join(host.cache_dir(), "versions-" .. host.edition() .. "-" .. Target.host_string() .. "-" .. host.arch() .. ".json")
+end
+
+local function read_cache(cache_fn)
+    local cache_json, _ = host.read_file(cache_fn)
+    if not cache_json then
+        return nil
+    end
+    local djOk, cached = pcall(json.decode, cache_json)
+    if not djOk or type(cached) ~= "table" or not cached.created or cached.format ~= cache_format then
+        return nil
+    end
+    -- Versions of another feed (see MONGOD_VERSIONS_URL) do not count.
+    if (cached.url or default_versions_url) ~= versions.__url() then
+        return nil
+    end
+    return cached
+end
+
+local function write_cache(cache_fn, cache)
+    local f, err = io.open(cache_fn, "w")
+    if not f then
+        error("Cannot open " .. cache_fn .. " for storing the cache inside: " .. tostring(err))
+    end
+    local cache_content, eErr = json.encode(cache)
+    if not cache_content then
+        f:close()
+        error("Cannot encode the cache for " .. cache_fn .. ": " .. tostring(eErr))
+    end
+    f:write(cache_content)
+    f:close()
+end
+
+local function is_offline()
+    local v = os.getenv("MONGOD_OFFLINE")
+    return v == "1" or v == "true" or v == "yes"
 end
 
 function versions.__get_all()
     local now = os.time()
     local cache_fn = cache_file_name()
 
-    local cache
-    local cache_json, _ = host.read_file(cache_fn)
-    if cache_json then
-        local djOk, cached = pcall(json.decode, cache_json)
-        if djOk and cached.created and (now - cached.created) < cache_ttl then
-            cache = cached
+    local cache = read_cache(cache_fn)
+    if is_offline() then
+        if not cache or not cache.versions then
+            error(("MONGOD_OFFLINE is set, but there are no cached versions in %s."):format(cache_fn))
         end
+        return cache.versions, cache.latest
     end
 
-    if not cache then
-        local vs, latest = versions.__fetch()
-        cache = {
-            created = now,
-            latest = latest,
-            versions = vs,
-        }
+    -- The TTL only matters (and is only validated) if there is a cache to expire.
+    if not cache or (now - cache.created) >= versions.cache_ttl() then
+        local validators
+        if cache and cache.versions then
+            validators = {
+                etag = cache.etag,
+                last_modified = cache.last_modified,
+            }
+        end
 
-        local f, err = io.open(cache_fn, "w")
-        if not f then
-            error("Cannot open " .. cache_fn .. " for storing the cache inside: " .. tostring(err))
+        local fOk, vs, latest, new_validators = pcall(versions.__fetch, validators)
+        if not fOk then
+            if not validators then
+                error(vs, 0)
+            end
+            -- Better stale versions than no versions at all (offline, proxy outage, ...).
+            host.warn(("%s; using the cached versions from %s instead."):format(
+                tostring(vs):gsub("^[^:]+:%d+: ", ""),
+                os.date("!%Y-%m-%d %H:%M:%S UTC", cache.created)
+            ))
+            return cache.versions, cache.latest
         end
-        f:write(json.encode(cache))
-        f:close()
+
+        if vs then
+            cache = {
+                format = cache_format,
+                url = versions.__url(),
+                created = now,
+                latest = latest,
+                versions = vs,
+                etag = new_validators.etag,
+                last_modified = new_validators.last_modified,
+            }
+        else
+            -- Not modified since the last fetch, so simply extend the cache.
+            cache.created = now
+        end
+
+        write_cache(cache_fn, cache)
     end
 
     return cache.versions, cache.latest
 end
 
+-- Returns all cached versions of the cache directory (for every edition,
+-- target and arch) sorted by their files. Caches which cannot be read (or
+-- are of an older format) are always expired.
+function versions.list_caches()
+    local dir = host.cache_dir()
+    local now = os.time()
+    local ttl = versions.cache_ttl()
+
+    local result = {}
+    for _, name in ipairs(host.list_dir(dir)) do
+        local edition, target, arch = name:match("^versions%-(%a+)%-(.+)%-([%w_]+)%.json$")
+        if edition then
+            local entry = {
+                file = host.path_join(dir, name),
+                edition = edition,
+                target = target,
+                arch = arch,
+                expired = true,
+            }
+            local djOk, cached = pcall(json.decode, host.read_file(entry.file) or "")
+            if djOk and type(cached) == "table" and cached.format == cache_format and type(cached.created) == "number" then
+                entry.url = cached.url or default_versions_url
+                entry.created = cached.created
+                entry.expired = (now - cached.created) >= ttl
+            end
+            table.insert(result, entry)
+        end
+    end
+
+    table.sort(result, function(a, b)
+        return a.file < b.file
+    end)
+    return result
+end
+
+local function remove_caches(filter)
+    local result = {}
+    for _, entry in ipairs(versions.list_caches()) do
+        if filter(entry) then
+            local ok, err = os.remove(entry.file)
+            if not ok then
+                error(("Cannot remove %s: %s"):format(entry.file, tostring(err)))
+            end
+            table.insert(result, entry)
+        end
+    end
+    return result
+end
+
+-- Removes all expired caches (see versions.list_caches) and returns them.
+-- Keep in mind that expired caches are still used if the versions cannot be
+-- fetched (or with MONGOD_OFFLINE).
+function versions.prune_caches()
+    return remove_caches(function(entry)
+        return entry.expired
+    end)
+end
+
+-- Removes all caches (of every edition and arch) of the given target (like
+-- ubuntu2404) or of the target of this host, and returns them.
+function versions.invalidate_caches(target)
+    target = target or Target.host_string()
+    return remove_caches(function(entry)
+        return entry.target == target
+    end)
+end
+
+-- Compares two version strings like Semver.cmp, but with numeric suffixes
+-- (MongoDB calls its release candidates rc0 to rcN, so 8.2.0-rc10 is newer
+-- than 8.2.0-rc2). Versions which cannot be interpreted at all are older than
+-- every valid one. This is the only ordering of MongoDB versions; everything
+-- which picks the newest version or sorts versions (like latest, aliases and
+-- get_all) has to use it.
+function versions.__cmp(a, b)
+    local sa, sb = Semver:new(a), Semver:new(b)
+    if not sa and not sb then
+        -- Both are invalid; at least be deterministic.
+        if a == b then
+            return 0
+        end
+        return a > b and 1 or -1
+    end
+
+    return Semver.cmp(sa, sb, { numeric_suffixes = true })
+end
+
 function versions.get_all()
     local result = {}
 
@@ -132,32 +412,87 @@ function versions.get_all()
 
     for key, value in pairs(all) do
         value["version"] = key
+        value["url"] = versions.__mirror(value.url)
         table.insert(result, value)
     end
 
     table.sort(result, function(a, b)
-        return a.version > b.version
+        return versions.__cmp(a.version, b.version) > 0
     end)
 
     return result
 end
 
-function versions.get(version)
-    local all, latest = versions.__get_all()
-    local resolved_version = version
+local function includes_release_candidates()
+    local v = os.getenv("MONGOD_RELEASE_CANDIDATES")
+    return v == "1" or v == "true" or v == "yes"
+end
 
+-- Returns the newest of all versions for which the given filter is true.
+local function newest(all, filter)
+    local result
+    for key, value in pairs(all) do
+        if filter(key, value) and (not result or versions.__cmp(key, result) > 0) then
+            result = key
+        end
+    end
+    return result
+end
+
+-- Resolves the given requested version to a version which exists in all.
+-- Besides exact versions, this supports the aliases latest (or current), lts
+-- and rapid and version prefixes like 8 and 8.0, which resolve to the newest
+-- production release matching them. Release candidates are only considered
+-- if MONGOD_RELEASE_CANDIDATES is set.
+function versions.__resolve(version, all, latest)
     if version == "latest" or version == "current" then
         if not latest then
             error("Currently there is no information about the latest version available. You need to explicitly point to a version.")
         end
-        resolved_version = latest
+        return latest
     end
 
-    local result = all[resolved_version]
+    if all[version] then
+        return version
+    end
+
+    local with_rcs = includes_release_candidates()
+    local function is_release(value)
+        return value.production == true or (with_rcs and value.release_candidate == true)
+    end
+
+    if version == "lts" then
+        return newest(all, function(_, value)
+            return is_release(value) and value.lts == true
+        end)
+    end
+
+    if version == "rapid" then
+        return newest(all, function(_, value)
+            return is_release(value) and value.lts ~= true
+        end)
+    end
+
+    if version:match("^%d+$") or version:match("^%d+%.%d+$") then
+        return newest(all, function(key, value)
+            local rest = key:sub(#version + 1)
+            return is_release(value) and key:sub(1, #version) == version and (rest:match("^%.") or rest:match("^%-"))
+        end)
+    end
+
+    return nil
+end
+
+function versions.get(version)
+    local all, latest = versions.__get_all()
+    local resolved_version = versions.__resolve(version, all, latest)
+
+    local result = resolved_version and all[resolved_version]
     if not result then
-        error(string.format("Version %s does not exist for %s/%s", resolved_version, Target.host_string(), host.arch()))
+        error(string.format("Version %s does not exist for %s/%s", version, Target.host_string(), host.arch()))
     end
     result["version"] = resolved_version
+    result["url"] = versions.__mirror(result.url)
     return result
 end
 
@@ -1,7 +1,11 @@
 package test
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestSemver_new(t *testing.T) {
@@ -17,6 +21,16 @@ func TestSemver_new(t *testing.T) {
 		{`"1.2.3"`, map[string]any{"major": float64(1), "minor": float64(2), "patch": float64(3)}, ""},
 		{`"1.2.0"`, map[string]any{"major": float64(1), "minor": float64(2), "patch": float64(0)}, ""},
 		{`"0.0.0"`, map[string]any{"major": float64(0), "minor": float64(0), "patch": float64(0)}, ""},
+		{`"1.2.3-rc1"`, map[string]any{"major": float64(1), "minor": float64(2), "patch": float64(3), "prerelease": "rc1"}, ""},
+		{`"1.2.3-alpha.1.x-y"`, map[string]any{"major": float64(1), "minor": float64(2), "patch": float64(3), "prerelease": "alpha.1.x-y"}, ""},
+		{`"1.2.3+build.5"`, map[string]any{"major": float64(1), "minor": float64(2), "patch": float64(3), "build": "build.5"}, ""},
+		{`"1.2.3-rc.1+001"`, map[string]any{"major": float64(1), "minor": float64(2), "patch": float64(3), "prerelease": "rc.1", "build": "001"}, ""},
+		{`"1.2.3-"`, nil, ""},
+		{`"1.2.3+"`, nil, ""},
+		{`"1.2.3-rc..1"`, nil, ""},
+		{`"1.2.3-rc.01"`, nil, ""},
+		{`"1.2.3-rc_1"`, nil, ""},
+		{`"1.2.3.4"`, nil, ""},
 		{`1`, nil, "requires a string to create a semver from; but got number"},
 		{`"a"`, nil, ""},
 		{`"1.b"`, nil, ""},
@@ -24,6 +38,8 @@ func TestSemver_new(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.input, func(t *testing.T) {
+			t.Parallel()
+			tc := tc.GivenClone(t)
 			if expectedErr := c.expectedErr; expectedErr == "" {
 				tc.ShouldEvaluateTo(t, `return t:new(`+c.input+`)`, c.expected)
 			} else {
@@ -56,11 +72,30 @@ func TestSemver_cmp(t *testing.T) {
 		{"1.2.3", "1.2.3", 0},
 		{"1.2.4", "1.2.3", 1},
 		{"1.2.3", "1.2.4", -1},
+
+		// Precedence as defined by SemVer 2.0
+		{"1.0.0", "1.0.0-rc.1", 1},
+		{"1.0.0-rc.1", "1.0.0-beta.11", 1},
+		{"1.0.0-beta.11", "1.0.0-beta.2", 1},
+		{"1.0.0-beta.2", "1.0.0-beta", 1},
+		{"1.0.0-beta", "1.0.0-alpha.beta", 1},
+		{"1.0.0-alpha.beta", "1.0.0-alpha.1", 1},
+		{"1.0.0-alpha.1", "1.0.0-alpha", 1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-rc1", "0.9.9", 1},
+		{"1.0.0-rc10", "1.0.0-rc2", -1}, // Lexically in ASCII order
+		{"1.0.0-1", "1.0.0-a", -1},
+		{"1.0.0-a", "1.0.0-1", 1},
+		{"1.0.0-rc1", "1.0.0-rc1", 0},
+		{"1.0.0+build.1", "1.0.0+build.2", 0},
+		{"1.0.0-rc1+build.1", "1.0.0-rc1", 0},
 	}
 
 	t.Run("by_string", func(t *testing.T) {
 		for _, c := range cases {
 			t.Run(c.a+"_"+c.b, func(t *testing.T) {
+				t.Parallel()
+				tc := tc.GivenClone(t)
 				tc.ShouldEvaluateTo(t, `return t.cmp("`+c.a+`","`+c.b+`")`, c.expected)
 			})
 		}
@@ -68,6 +103,8 @@ func TestSemver_cmp(t *testing.T) {
 	t.Run("instance_by_string", func(t *testing.T) {
 		for _, c := range cases {
 			t.Run(c.a+"_"+c.b, func(t *testing.T) {
+				t.Parallel()
+				tc := tc.GivenClone(t)
 				tc.ShouldEvaluateTo(t, `local instance = t:new("`+c.a+`")
 if instance == nil then
 	return 0
@@ -79,6 +116,8 @@ return instance:cmp("`+c.b+`")`, c.expected)
 	t.Run("by_both_instances", func(t *testing.T) {
 		for _, c := range cases {
 			t.Run(c.a+"_"+c.b, func(t *testing.T) {
+				t.Parallel()
+				tc := tc.GivenClone(t)
 				tc.ShouldEvaluateTo(t, `return t.cmp(t:new("`+c.a+`"),t:new("`+c.b+`"))`, c.expected)
 			})
 		}
@@ -86,6 +125,8 @@ return instance:cmp("`+c.b+`")`, c.expected)
 	t.Run("by_a_instance_b_string", func(t *testing.T) {
 		for _, c := range cases {
 			t.Run(c.a+"_"+c.b, func(t *testing.T) {
+				t.Parallel()
+				tc := tc.GivenClone(t)
 				tc.ShouldEvaluateTo(t, `return t.cmp(t:new("`+c.a+`"),"`+c.b+`")`, c.expected)
 			})
 		}
@@ -93,11 +134,37 @@ return instance:cmp("`+c.b+`")`, c.expected)
 	t.Run("by_a_string_b_instance", func(t *testing.T) {
 		for _, c := range cases {
 			t.Run(c.a+"_"+c.b, func(t *testing.T) {
+				t.Parallel()
+				tc := tc.GivenClone(t)
 				tc.ShouldEvaluateTo(t, `return t.cmp("`+c.a+`",t:new("`+c.b+`"))`, c.expected)
 			})
 		}
 	})
 
+	t.Run("with_numeric_suffixes", func(t *testing.T) {
+		cases := []struct {
+			a, b     string
+			expected float64
+		}{
+			{"1.0.0-rc10", "1.0.0-rc2", 1},
+			{"1.0.0-rc2", "1.0.0-rc10", -1},
+			{"1.0.0-rc1", "1.0.0-alpha10", 1},
+			{"1.0.0-rc1", "1.0.0-rc", 1},
+			{"1.0.0-rc1x", "1.0.0-rc10", 1},
+			{"1.0.0-rc01", "1.0.0-rc1", -1},
+			{"1.0.0-rc.10", "1.0.0-rc.2", 1},
+			{"1.0.0", "1.0.0-rc10", 1},
+			{"1.0.0-rc10", "1.0.0-rc10", 0},
+		}
+		for _, c := range cases {
+			t.Run(c.a+"_"+c.b, func(t *testing.T) {
+				t.Parallel()
+				tc := tc.GivenClone(t)
+				tc.ShouldEvaluateTo(t, `return t.cmp("`+c.a+`","`+c.b+`",{numeric_suffixes = true})`, c.expected)
+			})
+		}
+	})
+
 	t.Run("by_both_nil", func(t *testing.T) {
 		tc.ShouldEvaluateTo(t, `return t.cmp(nil,nil)`, float64(0))
 	})
@@ -108,3 +175,77 @@ return instance:cmp("`+c.b+`")`, c.expected)
 		tc.ShouldEvaluateTo(t, `return t.cmp(nil,"1.2.3")`, float64(-1))
 	})
 }
+
+func TestSemver_tostring(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/Semver.lua")
+
+	cases := []string{"1.2.3", "1.2.3-rc1", "1.2.3+build.5", "1.2.3-rc.1+001"}
+
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			t.Parallel()
+			tc := tc.GivenClone(t)
+			tc.ShouldEvaluateTo(t, `return tostring(t:new("v`+c+`"))`, c)
+		})
+	}
+}
+
+func FuzzSemver_cmp(f *testing.F) {
+	tc := GivenContextWith(f, "../lib/Semver.lua")
+
+	f.Add([]byte("1.0.0"), []byte("1.0.0-rc.1"), []byte("1.0.0-alpha"))
+	f.Add([]byte{1, 2, 3}, []byte{1, 2, 3, 4, 5}, []byte{3, 2, 1, 200, 100})
+	f.Add([]byte{}, []byte{0}, []byte{0, 0, 0, 0, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, ra, rb, rc []byte) {
+		a, b, c := semverOf(ra), semverOf(rb), semverOf(rc)
+		for _, options := range []string{"nil", "{numeric_suffixes = true}"} {
+			cmp := func(x, y string) float64 {
+				return tc.ShouldEvaluate(t, `return t.cmp("`+x+`", "`+y+`", `+options+`)`).(float64)
+			}
+
+			require.Equal(t, float64(0), cmp(a, a), "%s should be equal to itself", a)
+
+			ab, ba := cmp(a, b), cmp(b, a)
+			require.Equal(t, -ab, ba, "cmp(%s, %s) should be the inverse of cmp(%s, %s)", a, b, b, a)
+
+			bc, ac := cmp(b, c), cmp(a, c)
+			if ab <= 0 && bc <= 0 {
+				require.LessOrEqual(t, ac, float64(0), "%s <= %s <= %s, so %s <= %s", a, b, c, a, c)
+			}
+			if ab >= 0 && bc >= 0 {
+				require.GreaterOrEqual(t, ac, float64(0), "%s >= %s >= %s, so %s >= %s", a, b, c, a, c)
+			}
+		}
+	})
+}
+
+// semverOf deterministically creates a valid semantic version from the given
+// bytes, which are consumed to choose the numbers and identifiers.
+func semverOf(data []byte) string {
+	next := func() byte {
+		if len(data) == 0 {
+			return 0
+		}
+		result := data[0]
+		data = data[1:]
+		return result
+	}
+	identifiers := []string{"alpha", "beta", "rc", "rc1", "rc2", "rc10", "rc01", "rc1x", "x-y", "0", "1", "2", "11"}
+	ids := func(n byte) string {
+		var result []string
+		for i := byte(0); i < n%4; i++ {
+			result = append(result, identifiers[int(next())%len(identifiers)])
+		}
+		return strings.Join(result, ".")
+	}
+
+	result := fmt.Sprintf("%d.%d.%d", next()%3, next()%3, next()%3)
+	if pre := ids(next()); pre != "" {
+		result += "-" + pre
+	}
+	if build := ids(next()); build != "" {
+		result += "+" + build
+	}
+	return result
+}
@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/echocat/slf4g/level"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -349,6 +351,56 @@ func TestTarget_host(t *testing.T) {
 	})
 }
 
+func TestTarget_host_debug(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/Target.lua")
+	tc.Setenv("MONGOD_DEBUG", "1")
+	osReleaseFn := filepath.Join(t.TempDir(), "os-release")
+	require.NoError(t, os.WriteFile(osReleaseFn, []byte(etcOsReleaseDebian13), 0600))
+
+	tc.ShouldEvaluateTo(t, `return tostring(t.host("linux", [[`+osReleaseFn+`]]))`, "debian13")
+
+	assert.Equal(t, []LogEntry{{
+		Level:   level.Debug,
+		Message: "Read os-release.",
+		Fields:  map[string]any{"file": osReleaseFn, "id": "debian", "version_id": "13"},
+	}, {
+		Level:   level.Debug,
+		Message: "Distribution matches os-release.",
+		Fields:  map[string]any{"distribution": "debian", "matched_by": "debian", "version_id": "13"},
+	}}, tc.Logs())
+
+	t.Run("bestOf", func(t *testing.T) {
+		tc.ResetLogs()
+
+		tc.ShouldEvaluateTo(t, `return t:new("debian13"):best_of({"windows", "debian11", "debian12", "debian10", "debian14", "ubuntu2404", "unknown"}, function(item)
+	return item
+end)`, "debian12")
+
+		var trail []string
+		for _, e := range tc.Logs() {
+			trail = append(trail, e.Fields["candidate"].(string)+": "+e.Message)
+		}
+		assert.Equal(t, []string{
+			"windows: Candidate rejected: other operating system or distribution.",
+			"debian11: Candidate is an older version of the same distribution; using it as fallback.",
+			"debian12: Candidate is an older version of the same distribution; using it as fallback.",
+			"debian10: Candidate rejected: the fallback found so far is newer.",
+			"debian14: Candidate rejected: newer version than the target.",
+			"ubuntu2404: Candidate rejected: other operating system or distribution.",
+			"unknown: Candidate rejected: its target cannot be interpreted.",
+		}, trail)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		tc.ResetLogs()
+		tc.Setenv("MONGOD_DEBUG", "")
+
+		tc.ShouldEvaluateTo(t, `return tostring(t.host("linux", [[`+osReleaseFn+`]]))`, "debian13")
+
+		assert.Empty(t, tc.Logs())
+	})
+}
+
 const (
 	etcOsReleaseUbuntu2402 = `PRETTY_NAME="Ubuntu 24.04.2 LTS"
 NAME="Ubuntu"
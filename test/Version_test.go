@@ -37,6 +37,14 @@ func TestVersion_new(t *testing.T) {
 	}
 }
 
+func TestVersion_concat(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/Version.lua")
+
+	tc.ShouldEvaluateTo(t, `return {t:new("1"):concat("."), type(t:new("1"):concat("."))}`, []any{"1", "string"})
+	tc.ShouldEvaluateTo(t, `return t:new("1.2.3"):concat("-")`, "1-2-3")
+	tc.ShouldEvaluateTo(t, `return tostring(t:new("8.0"))`, "8.0")
+}
+
 func TestVersion_cmp(t *testing.T) {
 	tc := GivenContextWith(t, "../lib/Version.lua")
 
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/echocat/slf4g/level"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksum_of(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/checksum.lua")
+
+	cases := []struct {
+		name     string
+		version  string
+		strict   string
+		expected any
+		err      string
+	}{
+		{"sha256", `{sha256 = "ABC", sha1 = "def"}`, "", []any{"sha256", "abc"}, ""},
+		{"sha1", `{sha1 = "DEF"}`, "", []any{"sha1", "def"}, ""},
+		{"emptySha256", `{sha256 = "", sha1 = "def"}`, "", []any{"sha1", "def"}, ""},
+		{"none", `{}`, "", []any{}, ""},
+		{"noneStrict", `{url = "https://foo/bar.tgz", version = "8.0.9"}`, "1", nil, "There is neither a sha256 nor a sha1 checksum available for https://foo/bar.tgz@8.0.9; refusing to install it because MONGOD_STRICT_CHECKSUMS is set."},
+		{"sha1Strict", `{sha1 = "def"}`, "1", []any{"sha1", "def"}, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc.Setenv("MONGOD_STRICT_CHECKSUMS", c.strict)
+			if c.err != "" {
+				tc.ShouldEvaluateToError(t, `return {t.of(`+c.version+`)}`, c.err)
+			} else {
+				tc.ShouldEvaluateTo(t, `return {t.of(`+c.version+`)}`, c.expected)
+			}
+		})
+	}
+}
+
+func TestChecksum_of_warnsWithoutChecksum(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/checksum.lua")
+
+	tc.ShouldEvaluateTo(t, `return {t.of({url = "https://foo/bar.tgz", version = "8.0.9"})}`, []any{})
+
+	assert.Equal(t, []LogEntry{{
+		Level:   level.Warn,
+		Message: "There is no checksum available for https://foo/bar.tgz@8.0.9; it cannot be verified.",
+		Fields:  map[string]any{},
+	}}, tc.Logs())
+}
+
+func TestChecksum_file(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/checksum.lua")
+	tc.OsType = "linux"
+
+	content := []byte("hello world\n")
+	fn := filepath.Join(t.TempDir(), "it's a file")
+	require.NoError(t, os.WriteFile(fn, content, 0600))
+	sha1Sum := sha1.Sum(content)
+	sha256Sum := sha256.Sum256(content)
+
+	tc.ShouldEvaluateTo(t, `return t.file([[`+fn+`]], "sha256")`, hex.EncodeToString(sha256Sum[:]))
+	tc.ShouldEvaluateTo(t, `return t.file([[`+fn+`]], "sha1")`, hex.EncodeToString(sha1Sum[:]))
+	tc.ShouldEvaluateToError(t, `return t.file([[`+fn+`]], "md5")`, "Unsupported checksum algorithm: md5")
+}
+
+func TestChecksum_verify(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/checksum.lua")
+	tc.OsType = "linux"
+
+	content := []byte("hello world\n")
+	fn := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(fn, content, 0600))
+	sha256Sum := sha256.Sum256(content)
+	expected := hex.EncodeToString(sha256Sum[:])
+
+	tc.ShouldEvaluateTo(t, `return t.verify([[`+fn+`]], {sha256 = "`+expected+`"})`, nil)
+	tc.ShouldEvaluateToError(t, `return t.verify([[`+fn+`]], {sha256 = "abc"})`, "Checksum mismatch of "+fn+": expected sha256 abc, but got "+expected+".")
+}
+
+func TestChecksum_remember(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/checksum.lua")
+	tc.OsType = "linux"
+	fs := tc.GivenFilesystem(t)
+
+	content := []byte("hello world\n")
+	fn := fs.Path("install", "foo.tgz")
+	require.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+	require.NoError(t, os.WriteFile(fn, content, 0600))
+	sha256Sum := sha256.Sum256(content)
+	expected := hex.EncodeToString(sha256Sum[:])
+
+	tc.ShouldEvaluateTo(t, `return {t.remembered("foo.tgz")}`, []any{})
+
+	tc.ShouldEvaluateTo(t, `t.remember("foo.tgz", "sha256", "`+expected+`")
+return {t.remembered("foo.tgz")}`, []any{"sha256", expected})
+	tc.ShouldEvaluateTo(t, `return t.verify_remembered([[`+fn+`]])`, nil)
+
+	tc.ShouldEvaluateTo(t, `t.remember("foo.tgz", "sha256", "abc")
+return nil`, nil)
+	tc.ShouldEvaluateToError(t, `return t.verify_remembered([[`+fn+`]])`, "Checksum mismatch of "+fn+": expected sha256 abc, but got "+expected+".")
+
+	t.Run("forgotten", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `t.remember("foo.tgz", nil)
+return {t.remembered("foo.tgz")}`, []any{})
+
+		tc.ResetLogs()
+		tc.ShouldEvaluateTo(t, `return t.verify_remembered([[`+fn+`]])`, nil)
+		assert.Len(t, tc.LogsMatching("There is no known checksum of "+fn+"; it cannot be verified."), 1)
+
+		tc.Setenv("MONGOD_STRICT_CHECKSUMS", "1")
+		defer tc.Setenv("MONGOD_STRICT_CHECKSUMS", "")
+		tc.ShouldEvaluateToError(t, `return t.verify_remembered([[`+fn+`]])`, "There is no known checksum of "+fn+"; refusing to install it because MONGOD_STRICT_CHECKSUMS is set.")
+	})
+}
@@ -0,0 +1,156 @@
+// Command mongod-cache lists, prunes or invalidates the cached versions of
+// the plugin (see versions.list_caches, versions.prune_caches and
+// versions.invalidate_caches).
+//
+// Usage (from within the test directory):
+//
+//	go run ./cmd/mongod-cache [-mise] list
+//	go run ./cmd/mongod-cache [-mise] prune
+//	go run ./cmd/mongod-cache [-mise] invalidate <target>...
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/echocat/vfox-mongod/test"
+)
+
+func main() {
+	var opts Options
+	flag.BoolVar(&opts.Mise, "mise", false, "Use the cache directory of MISE instead of the one of vfox.")
+	flag.StringVar(&opts.LibPath, "lib", test.DefaultLibPath, "Lib directory of the plugin.")
+	flag.Parse()
+
+	if err := Run(opts, flag.Args(), os.Stdout); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Options of Run.
+type Options struct {
+	// Mise selects the cache directory of MISE instead of the one of vfox.
+	Mise bool
+	// LibPath is the lib directory of the plugin.
+	LibPath string
+	// Env overlays the environment variables of the process.
+	Env map[string]string
+	// Clock replaces the current time. If nil, time.Now is used.
+	Clock func() time.Time
+}
+
+// Entry is a cache file as reported by versions.list_caches.
+type Entry struct {
+	File    string `json:"file"`
+	Edition string `json:"edition"`
+	Target  string `json:"target"`
+	Arch    string `json:"arch"`
+	Url     string `json:"url"`
+	Created int64  `json:"created"`
+	Expired bool   `json:"expired"`
+}
+
+// Run executes the given command (list, prune or invalidate <target>...) and
+// writes the affected cache files to out.
+func Run(opts Options, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("command required: list, prune or invalidate <target>...")
+	}
+
+	// The arguments are passed as environment variables (see evaluate), so
+	// they never need to be quoted for Lua.
+	var scripts []string
+	var env []map[string]string
+	switch args[0] {
+	case "list":
+		scripts, env = []string{`return t.list_caches()`}, []map[string]string{nil}
+	case "prune":
+		scripts, env = []string{`return t.prune_caches()`}, []map[string]string{nil}
+	case "invalidate":
+		if len(args) < 2 {
+			return fmt.Errorf("invalidate requires at least one target (like ubuntu2404)")
+		}
+		for _, target := range args[1:] {
+			scripts = append(scripts, `return t.invalidate_caches(os.getenv("MONGOD_CACHE_TARGET"))`)
+			env = append(env, map[string]string{"MONGOD_CACHE_TARGET": target})
+		}
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+	if len(args) > 1 && args[0] != "invalidate" {
+		return fmt.Errorf("%s does not accept arguments", args[0])
+	}
+
+	for i, script := range scripts {
+		entries, err := opts.evaluate(script, env[i])
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			status := "fresh"
+			if e.Expired {
+				status = "expired"
+			}
+			created := "-"
+			if e.Created > 0 {
+				created = time.Unix(e.Created, 0).UTC().Format(time.RFC3339)
+			}
+			url := e.Url
+			if url == "" {
+				url = "-"
+			}
+			_, _ = fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", e.File, status, created, url)
+		}
+	}
+	return nil
+}
+
+// evaluate evaluates the given script with t as the versions module; the
+// given environment variables overlay the ones of Options.Env.
+func (opts Options) evaluate(script string, env map[string]string) ([]Entry, error) {
+	c := test.NewContext()
+	defer c.Close()
+	switch runtime.GOOS {
+	case "windows":
+		c.OsType = "Windows"
+	default:
+		c.OsType = runtime.GOOS
+	}
+	c.ArchType = runtime.GOARCH
+	c.Clock = opts.Clock
+	for k, v := range opts.Env {
+		c.Setenv(k, v)
+	}
+	for k, v := range env {
+		c.Setenv(k, v)
+	}
+	if opts.Mise {
+		c.GivenMise()
+	}
+	if err := c.PreloadModules(opts.LibPath); err != nil {
+		return nil, err
+	}
+
+	result, err := c.Evaluate(`local t = require("versions")
+local json = require("json")
+local entries = (function() ` + script + ` end)()
+if #entries == 0 then
+	return "[]"
+end
+return json.encode(entries)`)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal([]byte(result.(string)), &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/echocat/vfox-mongod/test"
+)
+
+var now = time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+
+// givenCache creates a vfox cache directory with a fresh cache for
+// ubuntu2404 and an expired one for windows.
+func givenCache(t testing.TB) (Options, string) {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "echocat-vfox-mongod")
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "versions-community-ubuntu2404-x86_64.json"), []byte(`{"format":2,"created":`+strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)+`,"versions":{}}`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "versions-community-windows-x86_64.json"), []byte(`{"format":2,"created":`+strconv.FormatInt(now.Add(-48*time.Hour).Unix(), 10)+`,"url":"https://mirror.example.com/full.json","versions":{}}`), 0600))
+
+	return Options{
+		LibPath: "../../../lib",
+		Env:     map[string]string{"VFOX_CACHE": root},
+		Clock: func() time.Time {
+			return now
+		},
+	}, dir
+}
+
+func TestRun(t *testing.T) {
+	test.HookLogger(t)
+	opts, dir := givenCache(t)
+	ubuntu := filepath.Join(dir, "versions-community-ubuntu2404-x86_64.json")
+	windows := filepath.Join(dir, "versions-community-windows-x86_64.json")
+
+	var out bytes.Buffer
+	require.NoError(t, Run(opts, []string{"list"}, &out))
+	assert.Equal(t, ubuntu+"\tfresh\t2025-10-19T11:00:00Z\thttps://downloads.mongodb.org/full.json\n"+
+		windows+"\texpired\t2025-10-17T12:00:00Z\thttps://mirror.example.com/full.json\n", out.String())
+
+	out.Reset()
+	require.NoError(t, Run(opts, []string{"prune"}, &out))
+	assert.Equal(t, windows+"\texpired\t2025-10-17T12:00:00Z\thttps://mirror.example.com/full.json\n", out.String())
+	assert.NoFileExists(t, windows)
+	assert.FileExists(t, ubuntu)
+
+	out.Reset()
+	require.NoError(t, Run(opts, []string{"invalidate", "ubuntu2404", "macos"}, &out))
+	assert.Equal(t, ubuntu+"\tfresh\t2025-10-19T11:00:00Z\thttps://downloads.mongodb.org/full.json\n", out.String())
+	assert.NoFileExists(t, ubuntu)
+
+	out.Reset()
+	require.NoError(t, Run(opts, []string{"list"}, &out))
+	assert.Empty(t, out.String())
+}
+
+func TestRun_invalidate_anyTarget(t *testing.T) {
+	test.HookLogger(t)
+	opts, dir := givenCache(t)
+	// Go would quote the first as \u200b, which Lua does not know.
+	for _, target := range []string{"zero\u200bwidth", `quote"and\backslash`} {
+		fn := filepath.Join(dir, "versions-community-"+target+"-x86_64.json")
+		require.NoError(t, os.WriteFile(fn, []byte(`{"format":2,"created":`+strconv.FormatInt(now.Unix(), 10)+`,"versions":{}}`), 0600))
+
+		var out bytes.Buffer
+		require.NoError(t, Run(opts, []string{"invalidate", target}, &out))
+		assert.Equal(t, fn+"\tfresh\t2025-10-19T12:00:00Z\thttps://downloads.mongodb.org/full.json\n", out.String())
+		assert.NoFileExists(t, fn)
+	}
+}
+
+func TestRun_illegal(t *testing.T) {
+	opts, _ := givenCache(t)
+
+	assert.EqualError(t, Run(opts, nil, nil), "command required: list, prune or invalidate <target>...")
+	assert.EqualError(t, Run(opts, []string{"clear"}, nil), "unknown command: clear")
+	assert.EqualError(t, Run(opts, []string{"invalidate"}, nil), "invalidate requires at least one target (like ubuntu2404)")
+	assert.EqualError(t, Run(opts, []string{"list", "windows"}, nil), "list does not accept arguments")
+}
@@ -0,0 +1,65 @@
+// Command mongod-mirror builds a self-contained mirror of MongoDB downloads
+// (for example to seed an Artifactory) which can be used by the plugin with
+// MONGOD_VERSIONS_URL (and MONGOD_DOWNLOAD_BASE_URL).
+//
+// Usage (from within the test directory):
+//
+//	go run ./cmd/mongod-mirror \
+//		-versions 8.0.9,lts \
+//		-targets ubuntu2404,windows \
+//		-archs x86_64,arm64 \
+//		-output ./mirror \
+//		-base-url https://artifactory.example.com/mongodb
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/echocat/vfox-mongod/test"
+)
+
+func main() {
+	var opts Options
+	var versions, targets, archs, editions string
+	flag.StringVar(&opts.Source, "source", defaultSource, "URL of the full.json to mirror.")
+	flag.StringVar(&versions, "versions", "", "Comma separated versions to mirror (like 8.0.9, 8.0 or lts).")
+	flag.StringVar(&targets, "targets", "", "Comma separated targets to mirror (like ubuntu2404, windows or macos).")
+	flag.StringVar(&archs, "archs", "x86_64", "Comma separated architectures to mirror (like x86_64 or arm64).")
+	flag.StringVar(&editions, "editions", "community", "Comma separated editions to mirror (community and/or enterprise).")
+	flag.StringVar(&opts.Output, "output", "mirror", "Directory to write the mirror to.")
+	flag.StringVar(&opts.BaseUrl, "base-url", "", "URL the output directory will be served at.")
+	flag.StringVar(&opts.LibPath, "lib", test.DefaultLibPath, "Lib directory of the plugin.")
+	flag.BoolVar(&opts.ReleaseCandidates, "release-candidates", false, "Let the versions resolve to release candidates, too.")
+	flag.Parse()
+
+	opts.Versions = splitList(versions)
+	opts.Targets = splitList(targets)
+	opts.Archs = splitList(archs)
+	opts.Editions = splitList(editions)
+	if len(opts.Versions) == 0 || len(opts.Targets) == 0 || len(opts.Archs) == 0 || opts.BaseUrl == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	archives, err := Build(opts)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	for _, a := range archives {
+		fmt.Printf("%s\t%s\n", a.Version, a.Url)
+	}
+}
+
+func splitList(s string) []string {
+	var result []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/echocat/slf4g"
+
+	"github.com/echocat/vfox-mongod/test"
+)
+
+const defaultSource = "https://downloads.mongodb.org/full.json"
+
+// Options of a mirror which is built by Build.
+type Options struct {
+	// Source is the url of the full.json to mirror.
+	Source string
+	// Versions to mirror; everything the plugin can resolve (like 8.0.9, 8.0
+	// or lts) is supported.
+	Versions []string
+	// Targets to mirror, like ubuntu2404, windows or macos.
+	Targets []string
+	// Archs to mirror, like x86_64 or arm64 (as MONGOD_ARCH accepts them).
+	Archs []string
+	// Editions to mirror, community and/or enterprise.
+	Editions []string
+	// Output is the directory the mirror is written to.
+	Output string
+	// BaseUrl is the url the Output directory will be served at; all urls of
+	// the written full.json point below it.
+	BaseUrl string
+	// LibPath is the lib directory of the plugin.
+	LibPath string
+	// ReleaseCandidates lets the versions (like 8.2 or latest) resolve to
+	// release candidates, too (like MONGOD_RELEASE_CANDIDATES does).
+	ReleaseCandidates bool
+
+	Client *http.Client
+}
+
+// Archive is a download which was selected for the mirror.
+type Archive struct {
+	Version string `json:"version"`
+	Url     string `json:"url"`
+	Sha1    string `json:"sha1"`
+	Sha256  string `json:"sha256"`
+}
+
+// Build selects the archives of all requested versions for every requested
+// target, arch and edition from the full.json of Options.Source (exactly
+// like the plugin does), downloads and verifies them and writes them together
+// with a trimmed full.json (only containing them, with rewritten urls) into
+// Options.Output. The archives are stored with the path of their original
+// url, so the mirror can be used either with MONGOD_VERSIONS_URL alone or
+// together with MONGOD_DOWNLOAD_BASE_URL.
+func Build(opts Options) ([]Archive, error) {
+	if opts.Source == "" {
+		opts.Source = defaultSource
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if len(opts.Editions) == 0 {
+		opts.Editions = []string{"community"}
+	}
+	if opts.BaseUrl == "" {
+		return nil, fmt.Errorf("base url is required")
+	}
+
+	fullJson, err := opts.fetch(opts.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	var archives []Archive
+	selected := map[string]Archive{}
+	for _, target := range opts.Targets {
+		for _, arch := range opts.Archs {
+			for _, edition := range opts.Editions {
+				as, err := opts.selectArchives(fullJson, target, arch, edition)
+				if err != nil {
+					return nil, err
+				}
+				for _, a := range as {
+					if _, ok := selected[a.Url]; !ok {
+						selected[a.Url] = a
+						archives = append(archives, a)
+					}
+				}
+			}
+		}
+	}
+
+	for _, a := range archives {
+		if err := opts.download(a); err != nil {
+			return nil, err
+		}
+	}
+
+	trimmed, err := opts.trim(fullJson, selected)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opts.Output, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(opts.Output, "full.json"), trimmed, 0644); err != nil {
+		return nil, err
+	}
+
+	return archives, nil
+}
+
+func (opts Options) fetch(u string) ([]byte, error) {
+	resp, err := opts.Client.Get(u)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch %s: %w", u, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot fetch %s: status %d", u, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// selectArchives lets the plugin itself (versions.__fetch and
+// versions.__resolve) select the archives of the requested versions for the
+// given target, arch and edition. The environment of the process is hidden
+// from the plugin, so only the Options decide what is selected.
+func (opts Options) selectArchives(fullJson []byte, target, arch, edition string) ([]Archive, error) {
+	c := test.NewContext()
+	defer c.Close()
+	c.IsolatedEnv = true
+	switch target {
+	case "windows":
+		c.OsType = "Windows"
+	case "macos":
+		c.OsType = "darwin"
+	default:
+		c.OsType = "linux"
+	}
+	c.Setenv("MONGOD_TARGET", target)
+	c.Setenv("MONGOD_ARCH", arch)
+	c.Setenv("MONGOD_EDITION", edition)
+	c.Setenv("MONGOD_VERSIONS_URL", opts.Source)
+	if opts.ReleaseCandidates {
+		c.Setenv("MONGOD_RELEASE_CANDIDATES", "1")
+	}
+	c.HTTP().GivenFixtureBody(opts.Source, fullJson)
+	if err := c.PreloadModules(opts.LibPath); err != nil {
+		return nil, err
+	}
+
+	request, err := json.Marshal(map[string]any{
+		"versions": opts.Versions,
+		"target":   target,
+		"arch":     arch,
+		"edition":  edition,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.Evaluate(`local json = require("json")
+local versions = require("versions")
+local request = json.decode([==[` + string(request) + `]==])
+local all, latest = versions.__fetch()
+local result = {}
+for _, requested in ipairs(request.versions) do
+	local version = versions.__resolve(requested, all, latest)
+	if not version then
+		error(("Version %s does not exist for %s/%s (%s)"):format(requested, request.target, request.arch, request.edition))
+	end
+	table.insert(result, {version = version, url = all[version].url, sha1 = all[version].sha1, sha256 = all[version].sha256})
+end
+return json.encode(result)`)
+	if err != nil {
+		return nil, err
+	}
+
+	var archives []Archive
+	if err := json.Unmarshal([]byte(result.(string)), &archives); err != nil {
+		return nil, err
+	}
+	return archives, nil
+}
+
+func (opts Options) download(a Archive) error {
+	u, err := url.Parse(a.Url)
+	if err != nil {
+		return err
+	}
+	output := filepath.Clean(opts.Output)
+	fn := filepath.Join(output, filepath.FromSlash(u.Path))
+	if !strings.HasPrefix(fn, output+string(filepath.Separator)) {
+		return fmt.Errorf("illegal path of %s: it is outside of %s", a.Url, opts.Output)
+	}
+
+	var h hash.Hash
+	var expected string
+	switch {
+	case a.Sha256 != "":
+		h, expected = sha256.New(), a.Sha256
+	case a.Sha1 != "":
+		h, expected = sha1.New(), a.Sha1
+	default:
+		return fmt.Errorf("there is no checksum for %s", a.Url)
+	}
+
+	log.With("url", a.Url).With("file", fn).Info("Downloading...")
+	resp, err := opts.Client.Get(a.Url)
+	if err != nil {
+		return fmt.Errorf("cannot download %s: %w", a.Url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot download %s: status %d", a.Url, resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(fn + ".part")
+	if err != nil {
+		return err
+	}
+	// Never leave a partial download behind; after the rename there is
+	// nothing left to remove.
+	defer func() { _ = os.Remove(fn + ".part") }()
+	if _, err := io.Copy(io.MultiWriter(f, h), resp.Body); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("cannot download %s: %w", a.Url, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("checksum mismatch of %s: expected %s, but got %s", a.Url, expected, actual)
+	}
+	return os.Rename(fn+".part", fn)
+}
+
+// trim removes every version and download of the given full.json which was
+// not selected and rewrites the urls of the selected ones to Options.BaseUrl.
+func (opts Options) trim(fullJson []byte, selected map[string]Archive) ([]byte, error) {
+	var body map[string]any
+	if err := json.Unmarshal(fullJson, &body); err != nil {
+		return nil, err
+	}
+	vs, _ := body["versions"].([]any)
+
+	var trimmedVersions []any
+	for _, v := range vs {
+		version, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		ds, _ := version["downloads"].([]any)
+		var trimmedDownloads []any
+		for _, d := range ds {
+			download, _ := d.(map[string]any)
+			archive, _ := download["archive"].(map[string]any)
+			u, _ := archive["url"].(string)
+			if _, ok := selected[u]; !ok {
+				continue
+			}
+			rewritten, err := opts.rewrite(u)
+			if err != nil {
+				return nil, err
+			}
+			archive["url"] = rewritten
+			trimmedDownloads = append(trimmedDownloads, download)
+		}
+		if len(trimmedDownloads) > 0 {
+			version["downloads"] = trimmedDownloads
+			trimmedVersions = append(trimmedVersions, version)
+		}
+	}
+	body["versions"] = trimmedVersions
+
+	return json.MarshalIndent(body, "", "  ")
+}
+
+func (opts Options) rewrite(u string) (string, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(opts.BaseUrl, "/") + pu.Path, nil
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/echocat/vfox-mongod/test"
+)
+
+const libPath = "../../../lib"
+
+// givenFixtureServer serves a full.json with the given versions (for windows
+// and ubuntu2404 on x86_64 and ubuntu2204 on aarch64, each in the community
+// and enterprise edition) and the archives of them. The content of every
+// archive is its own path; checksums returns the sha1 and sha256 which are
+// reported for the archive of the given path.
+func givenFixtureServer(t testing.TB, checksums func(path string) (string, string), versions ...string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	newDownload := func(target, arch, edition, path string) map[string]any {
+		sha1Sum, sha256Sum := checksums(path)
+		return map[string]any{
+			"target":  target,
+			"arch":    arch,
+			"edition": edition,
+			"archive": map[string]any{
+				"url":    srv.URL + path,
+				"sha1":   sha1Sum,
+				"sha256": sha256Sum,
+			},
+		}
+	}
+
+	var vs []any
+	for _, v := range versions {
+		vs = append(vs, map[string]any{
+			"version":            v,
+			"production_release": !strings.Contains(v, "-rc"),
+			"lts_release":        v == "8.0.9",
+			"notes":              "https://docs.mongodb.org/master/release-notes/" + v + "/",
+			"downloads": []any{
+				newDownload("windows", "x86_64", "base", "/windows/mongodb-windows-x86_64-"+v+".zip"),
+				newDownload("windows", "x86_64", "enterprise", "/windows/mongodb-windows-x86_64-enterprise-"+v+".zip"),
+				newDownload("ubuntu2404", "x86_64", "targeted", "/linux/mongodb-linux-x86_64-ubuntu2404-"+v+".tgz"),
+				newDownload("ubuntu2404", "x86_64", "enterprise", "/linux/mongodb-linux-x86_64-enterprise-ubuntu2404-"+v+".tgz"),
+				newDownload("ubuntu2204", "aarch64", "targeted", "/linux/mongodb-linux-aarch64-ubuntu2204-"+v+".tgz"),
+				newDownload("ubuntu2204", "aarch64", "enterprise", "/linux/mongodb-linux-aarch64-enterprise-ubuntu2204-"+v+".tgz"),
+			},
+		})
+	}
+	fullJson, err := json.Marshal(map[string]any{"versions": vs})
+	require.NoError(t, err)
+
+	mux.HandleFunc("/full.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(fullJson)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	})
+
+	return srv
+}
+
+func correctChecksums(path string) (string, string) {
+	sha1Sum, sha256Sum := sha1.Sum([]byte(path)), sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sha1Sum[:]), hex.EncodeToString(sha256Sum[:])
+}
+
+func TestBuild(t *testing.T) {
+	test.HookLogger(t)
+	srv := givenFixtureServer(t, correctChecksums, "7.0.14", "8.0.9", "8.2.1")
+	output := t.TempDir()
+
+	archives, err := Build(Options{
+		Source:   srv.URL + "/full.json",
+		Versions: []string{"lts", "8.2"},
+		Targets:  []string{"ubuntu2404", "windows", "ubuntu2504"},
+		Archs:    []string{"x86_64"},
+		Editions: []string{"community", "enterprise"},
+		Output:   output,
+		BaseUrl:  "https://artifactory.example.com/mongodb/",
+		LibPath:  libPath,
+	})
+	require.NoError(t, err)
+
+	var urls []string
+	for _, a := range archives {
+		urls = append(urls, a.Url)
+	}
+	assert.Equal(t, []string{
+		srv.URL + "/linux/mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz",
+		srv.URL + "/linux/mongodb-linux-x86_64-ubuntu2404-8.2.1.tgz",
+		srv.URL + "/linux/mongodb-linux-x86_64-enterprise-ubuntu2404-8.0.9.tgz",
+		srv.URL + "/linux/mongodb-linux-x86_64-enterprise-ubuntu2404-8.2.1.tgz",
+		srv.URL + "/windows/mongodb-windows-x86_64-8.0.9.zip",
+		srv.URL + "/windows/mongodb-windows-x86_64-8.2.1.zip",
+		srv.URL + "/windows/mongodb-windows-x86_64-enterprise-8.0.9.zip",
+		srv.URL + "/windows/mongodb-windows-x86_64-enterprise-8.2.1.zip",
+	}, urls, "ubuntu2504 should fall back to the archives of ubuntu2404.")
+
+	for _, path := range []string{
+		"/linux/mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz",
+		"/windows/mongodb-windows-x86_64-enterprise-8.2.1.zip",
+	} {
+		content, err := os.ReadFile(filepath.Join(output, filepath.FromSlash(path)))
+		require.NoError(t, err)
+		assert.Equal(t, path, string(content))
+	}
+	assert.NoFileExists(t, filepath.Join(output, "linux", "mongodb-linux-x86_64-ubuntu2404-7.0.14.tgz"))
+	assert.NoFileExists(t, filepath.Join(output, "linux", "mongodb-linux-aarch64-ubuntu2204-8.0.9.tgz"))
+
+	var trimmed struct {
+		Versions []struct {
+			Version           string `json:"version"`
+			ProductionRelease bool   `json:"production_release"`
+			Downloads         []struct {
+				Target  string `json:"target"`
+				Archive struct {
+					Url    string `json:"url"`
+					Sha256 string `json:"sha256"`
+				} `json:"archive"`
+			} `json:"downloads"`
+		} `json:"versions"`
+	}
+	data, err := os.ReadFile(filepath.Join(output, "full.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &trimmed))
+	require.Len(t, trimmed.Versions, 2)
+	assert.Equal(t, "8.0.9", trimmed.Versions[0].Version)
+	assert.True(t, trimmed.Versions[0].ProductionRelease)
+	assert.Len(t, trimmed.Versions[0].Downloads, 4)
+	assert.Equal(t, "8.2.1", trimmed.Versions[1].Version)
+	download := trimmed.Versions[1].Downloads[0]
+	assert.Equal(t, "windows", download.Target)
+	assert.Equal(t, "https://artifactory.example.com/mongodb/windows/mongodb-windows-x86_64-8.2.1.zip", download.Archive.Url)
+	_, expectedSha256 := correctChecksums("/windows/mongodb-windows-x86_64-8.2.1.zip")
+	assert.Equal(t, expectedSha256, download.Archive.Sha256, "Checksums should be kept.")
+}
+
+func TestBuild_sha1Fallback(t *testing.T) {
+	test.HookLogger(t)
+	srv := givenFixtureServer(t, func(path string) (string, string) {
+		sha1Sum, _ := correctChecksums(path)
+		return sha1Sum, ""
+	}, "8.0.9")
+	output := t.TempDir()
+
+	_, err := Build(Options{
+		Source:   srv.URL + "/full.json",
+		Versions: []string{"8.0.9"},
+		Targets:  []string{"ubuntu2204"},
+		Archs:    []string{"arm64"},
+		Output:   output,
+		BaseUrl:  "https://artifactory.example.com/mongodb",
+		LibPath:  libPath,
+	})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(output, "linux", "mongodb-linux-aarch64-ubuntu2204-8.0.9.tgz"))
+}
+
+func TestBuild_failures(t *testing.T) {
+	test.HookLogger(t)
+
+	cases := []struct {
+		name      string
+		checksums func(path string) (string, string)
+		versions  []string
+		err       string
+	}{
+		{"wrongChecksum", func(string) (string, string) { return "", "abc" }, []string{"8.0.9"}, "checksum mismatch of "},
+		{"missingChecksum", func(string) (string, string) { return "", "" }, []string{"8.0.9"}, "there is no checksum for "},
+		{"unknownVersion", correctChecksums, []string{"6.0.0"}, "Version 6.0.0 does not exist for ubuntu2404/x86_64 (community)"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := givenFixtureServer(t, c.checksums, "8.0.9")
+			output := t.TempDir()
+
+			_, err := Build(Options{
+				Source:   srv.URL + "/full.json",
+				Versions: c.versions,
+				Targets:  []string{"ubuntu2404"},
+				Archs:    []string{"x86_64"},
+				Output:   output,
+				BaseUrl:  "https://artifactory.example.com/mongodb",
+				LibPath:  libPath,
+			})
+			require.ErrorContains(t, err, c.err)
+			assert.NoFileExists(t, filepath.Join(output, "full.json"))
+			assert.NoFileExists(t, filepath.Join(output, "linux", "mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz"))
+			assert.NoFileExists(t, filepath.Join(output, "linux", "mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz.part"))
+		})
+	}
+}
+
+func TestBuild_truncated(t *testing.T) {
+	test.HookLogger(t)
+	srv := givenFixtureServer(t, correctChecksums, "8.0.9")
+	output := t.TempDir()
+
+	_, err := Build(Options{
+		Source:   srv.URL + "/full.json",
+		Versions: []string{"8.0.9"},
+		Targets:  []string{"ubuntu2404"},
+		Archs:    []string{"x86_64"},
+		Output:   output,
+		BaseUrl:  "https://artifactory.example.com/mongodb",
+		LibPath:  libPath,
+		Client:   &http.Client{Transport: truncatingTransport{}},
+	})
+	require.ErrorContains(t, err, "cannot download "+srv.URL+"/linux/mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz")
+	assert.NoFileExists(t, filepath.Join(output, "linux", "mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz"))
+	assert.NoFileExists(t, filepath.Join(output, "linux", "mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz.part"))
+}
+
+// truncatingTransport breaks the connection after the first bytes of every
+// archive.
+type truncatingTransport struct{}
+
+func (truncatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil || req.URL.Path == "/full.json" {
+		return resp, err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(io.LimitReader(resp.Body, 5), iotest.ErrReader(io.ErrUnexpectedEOF)), resp.Body}
+	return resp, nil
+}
+
+func TestBuild_ignoresEnvironment(t *testing.T) {
+	test.HookLogger(t)
+	srv := givenFixtureServer(t, correctChecksums, "8.0.9", "8.2.1", "8.2.2-rc0")
+	t.Setenv("MONGOD_RELEASE_CANDIDATES", "1")
+	t.Setenv("MONGOD_EDITION", "enterprise")
+	build := func(releaseCandidates bool) []Archive {
+		archives, err := Build(Options{
+			Source:            srv.URL + "/full.json",
+			Versions:          []string{"8.2"},
+			Targets:           []string{"ubuntu2404"},
+			Archs:             []string{"x86_64"},
+			Output:            t.TempDir(),
+			BaseUrl:           "https://artifactory.example.com/mongodb",
+			LibPath:           libPath,
+			ReleaseCandidates: releaseCandidates,
+		})
+		require.NoError(t, err)
+		return archives
+	}
+
+	assert.Equal(t, []Archive{{Version: "8.2.1", Url: srv.URL + "/linux/mongodb-linux-x86_64-ubuntu2404-8.2.1.tgz"}}, withoutChecksums(build(false)), "MONGOD_* of the process should not change the selection.")
+	assert.Equal(t, []Archive{{Version: "8.2.2-rc0", Url: srv.URL + "/linux/mongodb-linux-x86_64-ubuntu2404-8.2.2-rc0.tgz"}}, withoutChecksums(build(true)))
+}
+
+func withoutChecksums(archives []Archive) []Archive {
+	for i := range archives {
+		archives[i].Sha1, archives[i].Sha256 = "", ""
+	}
+	return archives
+}
+
+func TestBuild_pathOutsideOfOutput(t *testing.T) {
+	test.HookLogger(t)
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	_, sha256Sum := correctChecksums("/escaped.tgz")
+	fullJson, err := json.Marshal(map[string]any{"versions": []any{map[string]any{
+		"version":            "8.0.9",
+		"production_release": true,
+		"downloads": []any{map[string]any{
+			"target":  "ubuntu2404",
+			"arch":    "x86_64",
+			"edition": "targeted",
+			"archive": map[string]any{"url": srv.URL + "/linux/../../escaped.tgz", "sha256": sha256Sum},
+		}},
+	}}})
+	require.NoError(t, err)
+	var requested []string
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if r.URL.Path == "/full.json" {
+			_, _ = w.Write(fullJson)
+		} else {
+			_, _ = w.Write([]byte(r.URL.Path))
+		}
+	})
+	parent := t.TempDir()
+	output := filepath.Join(parent, "mirror")
+
+	_, err = Build(Options{
+		Source:   srv.URL + "/full.json",
+		Versions: []string{"8.0.9"},
+		Targets:  []string{"ubuntu2404"},
+		Archs:    []string{"x86_64"},
+		Output:   output,
+		BaseUrl:  "https://artifactory.example.com/mongodb",
+		LibPath:  libPath,
+	})
+	require.ErrorContains(t, err, "illegal path of "+srv.URL+"/linux/../../escaped.tgz: it is outside of "+output)
+	assert.NoFileExists(t, filepath.Join(parent, "escaped.tgz"))
+	assert.Equal(t, []string{"/full.json"}, requested, "Should not even download it.")
+}
@@ -0,0 +1,311 @@
+// Command mongod-stub behaves like mongod (or mongosh, if called like it)
+// as far as the helpers of the plugin (like mongod-instance) rely on it,
+// without being a database. The e2e tests install it as bin/mongod (see
+// test.BuildStubMongod).
+//
+// As mongod it supports -version and --config <file> (optionally followed by
+// --replSet <name> and --port <port>): it reads the storage.dbPath,
+// systemLog.path, net.bindIp, net.port, security.keyFile and
+// processManagement.fork/pidFilePath of the file, accepts (and immediately
+// closes) connections on the port, logs "Waiting for connections" like mongod
+// and runs until it gets terminated.
+//
+// As mongosh it supports --host, --port and --eval: it succeeds if it can
+// connect to the given host and port and appends the evaluated script to
+// the file of MONGOSH_STUB_EVAL_LOG (if set).
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// version reported by -version; can be changed with
+// -ldflags "-X main.version=...".
+var version = "8.0.9"
+
+// childEnv marks the child process of a forking mongod.
+const childEnv = "MONGOD_STUB_CHILD"
+
+func main() {
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	var code int
+	if strings.HasPrefix(name, "mongosh") {
+		code = runMongosh(os.Args[1:], os.Stdout, os.Stderr)
+	} else {
+		code = runMongod(os.Args[1:], os.Stdout, os.Stderr)
+	}
+	os.Exit(code)
+}
+
+func runMongosh(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("mongosh", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	host := flags.String("host", "127.0.0.1", "")
+	port := flags.Int("port", 27017, "")
+	eval := flags.String("eval", "", "")
+	flags.Bool("quiet", false, "")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(*host, strconv.Itoa(*port)), 5*time.Second)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "MongoServerSelectionError: %v\n", err)
+		return 1
+	}
+	_ = conn.Close()
+
+	if fn := os.Getenv("MONGOSH_STUB_EVAL_LOG"); fn != "" && *eval != "" {
+		f, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer func() { _ = f.Close() }()
+		if _, err := fmt.Fprintf(f, "%s:%d %s\n", *host, *port, *eval); err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	_, _ = fmt.Fprintln(stdout, "ok")
+	return 0
+}
+
+func runMongod(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 1 && (args[0] == "-version" || args[0] == "--version") {
+		_, _ = fmt.Fprintf(stdout, "db version v%s\n", version)
+		return 0
+	}
+	if len(args) < 2 || len(args)%2 != 0 || args[0] != "--config" {
+		_, _ = fmt.Fprintln(stderr, "Usage: mongod -version|--config <file> [--replSet <name>] [--port <port>]")
+		return 2
+	}
+
+	conf, err := readConfig(args[1])
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "Error reading config file: %v\n", err)
+		return 2
+	}
+	// Like mongod, arguments take precedence over the config file.
+	for i := 2; i < len(args); i += 2 {
+		switch args[i] {
+		case "--replSet":
+			conf["replication.replSetName"] = args[i+1]
+		case "--port":
+			conf["net.port"] = args[i+1]
+		default:
+			_, _ = fmt.Fprintf(stderr, "Error parsing command line: unrecognised option '%s'\n", args[i])
+			return 2
+		}
+	}
+
+	if conf["processManagement.fork"] == "true" && os.Getenv(childEnv) == "" {
+		return fork(args, conf, stdout)
+	}
+	return serve(conf, stderr)
+}
+
+// fork starts the actual mongod as child process and returns once it is
+// ready (has written its pid file) or has failed, like mongod does.
+func fork(args []string, conf map[string]string, stdout io.Writer) int {
+	pidFile := conf["processManagement.pidFilePath"]
+	if pidFile == "" {
+		_, _ = fmt.Fprintln(stdout, "ERROR: processManagement.fork requires processManagement.pidFilePath")
+		return 2
+	}
+	_ = os.Remove(pidFile)
+
+	self, err := os.Executable()
+	if err != nil {
+		_, _ = fmt.Fprintln(stdout, err)
+		return 1
+	}
+	cmd := exec.Command(self, args...)
+	cmd.Env = append(os.Environ(), childEnv+"=1")
+	if err := cmd.Start(); err != nil {
+		_, _ = fmt.Fprintln(stdout, err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(stdout, "about to fork child process, waiting until server is ready for connections.\nforked process: %d\n", cmd.Process.Pid)
+
+	exited := make(chan int, 1)
+	go func() {
+		_ = cmd.Wait()
+		exited <- cmd.ProcessState.ExitCode()
+	}()
+	for timeout := time.After(30 * time.Second); ; {
+		if _, err := os.Stat(pidFile); err == nil {
+			_, _ = fmt.Fprintln(stdout, "child process started successfully, parent exiting")
+			return 0
+		}
+		select {
+		case code := <-exited:
+			_, _ = fmt.Fprintf(stdout, "ERROR: child process failed, exited with %d\n", code)
+			return code
+		case <-timeout:
+			_, _ = fmt.Fprintln(stdout, "ERROR: child process did not get ready within 30 seconds")
+			return 1
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func serve(conf map[string]string, stderr io.Writer) int {
+	logger := &logger{w: stderr}
+	if fn := conf["systemLog.path"]; fn != "" {
+		f, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "Failed to open %s: %v\n", fn, err)
+			return 1
+		}
+		defer func() { _ = f.Close() }()
+		logger.w = f
+	}
+	logger.log("CONTROL", "Build Info", map[string]any{"version": version})
+
+	if dbPath := conf["storage.dbPath"]; dbPath != "" {
+		if fi, err := os.Stat(dbPath); err != nil || !fi.IsDir() {
+			logger.log("STORAGE", "Data directory not found", map[string]any{"dbpath": dbPath})
+			return 100
+		}
+	}
+	if keyFile := conf["security.keyFile"]; keyFile != "" {
+		fi, err := os.Stat(keyFile)
+		if err != nil {
+			logger.log("ACCESS", "Error reading file", map[string]any{"file": keyFile, "error": err.Error()})
+			return 1
+		}
+		if runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0 {
+			logger.log("ACCESS", "permissions on keyfile are too open", map[string]any{"file": keyFile})
+			return 1
+		}
+	}
+
+	bindIp, port := conf["net.bindIp"], conf["net.port"]
+	if bindIp == "" {
+		bindIp = "127.0.0.1"
+	}
+	if port == "" {
+		port = "27017"
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(bindIp, port))
+	if err != nil {
+		logger.log("NETWORK", "Error setting up listener", map[string]any{"error": err.Error()})
+		return 48
+	}
+	defer func() { _ = ln.Close() }()
+
+	if pidFile := conf["processManagement.pidFilePath"]; pidFile != "" {
+		if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+			logger.log("CONTROL", "Failed to write pid file", map[string]any{"error": err.Error()})
+			return 1
+		}
+	}
+	logger.log("NETWORK", "Waiting for connections", map[string]any{"port": port, "ssl": "off"})
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	logger.log("CONTROL", "Received signal", map[string]any{"signal": sig.String()})
+	logger.log("CONTROL", "Shutting down", nil)
+	return 0
+}
+
+// readConfig reads the subset of YAML which the plugin generates for
+// mongod.conf: sections with key value pairs, whose values are plain or
+// double quoted. The keys are returned as section.key.
+func readConfig(fn string) (map[string]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	result := map[string]string{}
+	var section string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected <key>: <value>, but got %q", fn, line, text)
+		}
+		value = strings.TrimSpace(value)
+		if text == trimmed {
+			if value != "" {
+				return nil, fmt.Errorf("%s:%d: expected a section, but got %q", fn, line, text)
+			}
+			section = key
+			continue
+		}
+		if section == "" {
+			return nil, fmt.Errorf("%s:%d: %q is outside of a section", fn, line, text)
+		}
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: illegal quoted value %s: %w", fn, line, value, err)
+			}
+			value = unquoted
+		}
+		result[section+"."+key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, errors.New(fn + " does not contain any setting")
+	}
+	return result, nil
+}
+
+// logger writes log entries in the JSON format of mongod (4.4+).
+type logger struct {
+	w io.Writer
+}
+
+func (l *logger) log(component, msg string, attr map[string]any) {
+	entry := map[string]any{
+		"t":   map[string]any{"$date": time.Now().Format(time.RFC3339Nano)},
+		"s":   "I",
+		"c":   component,
+		"msg": msg,
+	}
+	if attr != nil {
+		entry["attr"] = attr
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		panic(err)
+	}
+	_, _ = l.w.Write(append(b, '\n'))
+}
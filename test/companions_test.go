@@ -0,0 +1,288 @@
+package test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	shellFeedUrl = "https://downloads.mongodb.com/compass/mongosh.json"
+	toolsFeedUrl = "https://downloads.mongodb.org/tools/db/full.json"
+)
+
+// givenShellFeed synthesizes a mongosh.json (like the one of
+// downloads.mongodb.com) which offers every given version as archive for
+// windows, macos and linux on x64 and arm64, and as .deb and .msi packages.
+// The checksums are the ones of the given archive.
+func givenShellFeed(archive []byte, versions ...string) []byte {
+	sum := sha256.Sum256(archive)
+	newDownload := func(arch, distro, typ, url string) map[string]any {
+		return map[string]any{
+			"arch":   arch,
+			"distro": distro,
+			"archive": map[string]any{
+				"type":   typ,
+				"url":    url,
+				"sha256": hex.EncodeToString(sum[:]),
+			},
+		}
+	}
+
+	var result []map[string]any
+	for _, v := range versions {
+		base := "https://downloads.mongodb.com/compass/mongosh-" + v
+		result = append(result, map[string]any{
+			"version": v,
+			"downloads": []map[string]any{
+				newDownload("x64", "win32msi", "msi", base+"-x64.msi"),
+				newDownload("x64", "win32", "zip", base+"-win32-x64.zip"),
+				newDownload("x64", "darwin", "zip", base+"-darwin-x64.zip"),
+				newDownload("arm64", "darwin", "zip", base+"-darwin-arm64.zip"),
+				newDownload("x64", "debian", "deb", base+"_amd64.deb"),
+				newDownload("x64", "linux", "tgz", base+"-linux-x64.tgz"),
+				newDownload("arm64", "linux", "tgz", base+"-linux-arm64.tgz"),
+			},
+		})
+	}
+
+	data, err := json.Marshal(map[string]any{"versions": result})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// givenToolsFeed synthesizes a tools/db/full.json (like the one of
+// downloads.mongodb.org) which offers every given version for windows and
+// macos, for ubuntu2204 on x86_64 and aarch64 and for ubuntu2404 on x86_64.
+// The checksums are the ones of the given archive.
+func givenToolsFeed(archive []byte, versions ...string) []byte {
+	sum := sha256.Sum256(archive)
+	newDownload := func(name, arch, url string) map[string]any {
+		return map[string]any{
+			"name": name,
+			"arch": arch,
+			"archive": map[string]any{
+				"url":    url,
+				"sha256": hex.EncodeToString(sum[:]),
+			},
+		}
+	}
+
+	var result []map[string]any
+	for _, v := range versions {
+		base := "https://fastdl.mongodb.org/tools/db/mongodb-database-tools-"
+		result = append(result, map[string]any{
+			"version": v,
+			"downloads": []map[string]any{
+				newDownload("windows", "x86_64", base+"windows-x86_64-"+v+".zip"),
+				newDownload("macos", "x86_64", base+"macos-x86_64-"+v+".zip"),
+				newDownload("macos", "arm64", base+"macos-arm64-"+v+".zip"),
+				newDownload("ubuntu2204", "x86_64", base+"ubuntu2204-x86_64-"+v+".tgz"),
+				newDownload("ubuntu2204", "aarch64", base+"ubuntu2204-aarch64-"+v+".tgz"),
+				newDownload("ubuntu2404", "x86_64", base+"ubuntu2404-x86_64-"+v+".tgz"),
+			},
+		})
+	}
+
+	data, err := json.Marshal(map[string]any{"versions": result})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func TestCompanions___resolve(t *testing.T) {
+	shellFeed := givenShellFeed(nil, "2.3.1", "2.5.8", "2.6.0-beta.1", "2.5.10")
+	toolsFeed := givenToolsFeed(nil, "100.9.5", "100.13.0", "100.10.0")
+
+	// The filesystem only works with linux, so other operating systems are
+	// selected by MONGOD_TARGET.
+	cases := []struct {
+		companion   string
+		requested   string
+		target      string
+		version     string
+		archType    string
+		expectedUrl string
+		expectedErr string
+	}{
+		{"mongosh", "latest", "", "24.4", "amd64", "https://downloads.mongodb.com/compass/mongosh-2.5.10-linux-x64.tgz", ""},
+		{"mongosh", "latest", "", "24.4", "arm64", "https://downloads.mongodb.com/compass/mongosh-2.5.10-linux-arm64.tgz", ""},
+		{"mongosh", "2.3.1", "", "24.4", "amd64", "https://downloads.mongodb.com/compass/mongosh-2.3.1-linux-x64.tgz", ""},
+		{"mongosh", "2.6.0-beta.1", "", "24.4", "amd64", "https://downloads.mongodb.com/compass/mongosh-2.6.0-beta.1-linux-x64.tgz", ""},
+		{"mongosh", "latest", "windows", "", "amd64", "https://downloads.mongodb.com/compass/mongosh-2.5.10-win32-x64.zip", ""},
+		{"mongosh", "latest", "macos", "", "amd64", "https://downloads.mongodb.com/compass/mongosh-2.5.10-darwin-x64.zip", ""},
+		{"mongosh", "1.0.0", "", "24.4", "amd64", "", "Version 1.0.0 of mongosh does not exist for ubuntu2404/x86_64"},
+		{"mongosh", "latest", "", "24.4", "s390x", "", "Version latest of mongosh does not exist for ubuntu2404/s390x"},
+
+		{"database-tools", "latest", "", "24.4", "amd64", "https://fastdl.mongodb.org/tools/db/mongodb-database-tools-ubuntu2404-x86_64-100.13.0.tgz", ""},
+		{"database-tools", "latest", "", "25.4", "amd64", "https://fastdl.mongodb.org/tools/db/mongodb-database-tools-ubuntu2404-x86_64-100.13.0.tgz", ""},
+		{"database-tools", "latest", "", "24.4", "arm64", "https://fastdl.mongodb.org/tools/db/mongodb-database-tools-ubuntu2204-aarch64-100.13.0.tgz", ""},
+		{"database-tools", "100.9.5", "", "22.4", "amd64", "https://fastdl.mongodb.org/tools/db/mongodb-database-tools-ubuntu2204-x86_64-100.9.5.tgz", ""},
+		{"database-tools", "latest", "windows", "", "amd64", "https://fastdl.mongodb.org/tools/db/mongodb-database-tools-windows-x86_64-100.13.0.zip", ""},
+		{"database-tools", "latest", "", "20.4", "amd64", "", "Version latest of database-tools does not exist for ubuntu2004/x86_64"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.companion+"@"+c.requested+"/"+c.target+c.version+"/"+c.archType, func(t *testing.T) {
+			tc := GivenContextWith(t, "../lib/companions.lua")
+			tc.OsType = "linux"
+			tc.ArchType = c.archType
+			tc.DistributionType = "ubuntu"
+			tc.DistributionVersion = c.version
+			if c.target != "" {
+				tc.Setenv("MONGOD_TARGET", c.target)
+			}
+			tc.HTTP().
+				GivenFixtureBody(shellFeedUrl, shellFeed).
+				GivenFixtureBody(toolsFeedUrl, toolsFeed)
+
+			script := `for _, d in ipairs(t.__definitions) do
+	if d.name == "` + c.companion + `" then
+		return t.__resolve(d, "` + c.requested + `").url
+	end
+end`
+			if c.expectedErr != "" {
+				tc.ShouldEvaluateToError(t, script, c.expectedErr)
+			} else {
+				tc.ShouldEvaluateTo(t, script, c.expectedUrl)
+			}
+		})
+	}
+}
+
+func TestCompanions_requested(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/companions.lua")
+	tc.OsType = "linux"
+	tc.DistributionType = "ubuntu"
+	tc.DistributionVersion = "24.4"
+	tc.HTTP().
+		GivenFixtureBody(shellFeedUrl, givenShellFeed(nil, "2.5.8")).
+		GivenFixtureBody(toolsFeedUrl, givenToolsFeed(nil, "100.13.0"))
+
+	script := `local result = {}
+for _, c in ipairs(t.requested()) do
+	table.insert(result, c.name .. "@" .. c.version)
+end
+return result`
+
+	tc.ShouldEvaluateTo(t, script, []any{})
+	tc.HTTP().ShouldNotHaveRequested(t, shellFeedUrl)
+	tc.HTTP().ShouldNotHaveRequested(t, toolsFeedUrl)
+
+	tc.Setenv("MONGOD_WITH_SHELL", "1")
+	tc.ShouldEvaluateTo(t, script, []any{"mongosh@2.5.8"})
+
+	tc.Setenv("MONGOD_WITH_TOOLS", "true")
+	tc.ShouldEvaluateTo(t, script, []any{"mongosh@2.5.8", "database-tools@100.13.0"})
+
+	tc.Setenv("MONGOD_WITH_SHELL", "0")
+	tc.ShouldEvaluateTo(t, script, []any{"database-tools@100.13.0"})
+}
+
+func TestCompanions_install(t *testing.T) {
+	shellArchive := givenTgzArchive("mongosh-2.5.8-linux-x64", map[string]string{
+		"mongosh": "echo 2.5.8",
+	})
+	toolsArchive := givenTgzArchive("mongodb-database-tools-ubuntu2404-x86_64-100.13.0", map[string]string{
+		"mongodump":    "echo mongodump version: 100.13.0",
+		"mongorestore": "echo mongorestore version: 100.13.0",
+	})
+
+	for _, mise := range []bool{false, true} {
+		name := "vfox"
+		if mise {
+			name = "mise"
+		}
+		t.Run(name, func(t *testing.T) {
+			tc, fs := givenInstallContext(t, installChecksumsCorrect)
+			if mise {
+				tc.GivenMise()
+			}
+			tc.Setenv("MONGOD_WITH_SHELL", "1")
+			tc.Setenv("MONGOD_WITH_TOOLS", "1")
+			tc.HTTP().
+				GivenFixtureBody(shellFeedUrl, givenShellFeed(shellArchive, "2.5.8")).
+				GivenFixtureBody("https://downloads.mongodb.com/compass/mongosh-2.5.8-linux-x64.tgz", shellArchive).
+				GivenFixtureBody(toolsFeedUrl, givenToolsFeed(toolsArchive, "100.13.0")).
+				GivenFixtureBody("https://fastdl.mongodb.org/tools/db/mongodb-database-tools-ubuntu2404-x86_64-100.13.0.tgz", toolsArchive)
+			require.NoError(t, os.MkdirAll(fs.Path("install"), 0755))
+			require.NoError(t, os.WriteFile(fs.Path("install", installArchiveName), installArchive, 0644))
+			if !mise {
+				// Without MISE, the runtime already extracted the server archive.
+				require.NoError(t, os.Remove(fs.Path("install", installArchiveName)))
+				givenInstalledMongod(t, fs.Path("install"))
+			}
+
+			tc.ShouldEvaluateTo(t, `return PLUGIN:PostInstall({sdkInfo = {mongod = {path = [[`+fs.Path("install")+`]], version = "`+installVersion+`"}}})`, nil)
+
+			for _, fn := range []string{
+				filepath.Join("install", "bin", "mongod"),
+				filepath.Join("install", "mongosh", "bin", "mongosh"),
+				filepath.Join("install", "database-tools", "bin", "mongodump"),
+				filepath.Join("install", "database-tools", "bin", "mongorestore"),
+			} {
+				assert.True(t, fs.Exists(fn), "%s should exist.", fn)
+			}
+			assert.False(t, fs.Exists(filepath.Join("install", "mongosh-2.5.8-linux-x64.tar.gz")), "Archive of mongosh should be removed.")
+			assert.False(t, fs.Exists(filepath.Join("install", "mongodb-database-tools-ubuntu2404-x86_64-100.13.0.tar.gz")), "Archive of the database tools should be removed.")
+
+			tc.ShouldEvaluateTo(t, `local result = {}
+for _, env in ipairs(PLUGIN:EnvKeys({path = [[`+fs.Path("install")+`]]})) do
+	table.insert(result, env.key .. "=" .. env.value)
+end
+return result`, []any{
+				"PATH=" + fs.Path("install") + "/bin",
+				"PATH=" + fs.Path("install", "mongosh", "bin"),
+				"PATH=" + fs.Path("install", "database-tools", "bin"),
+				"MONGOD_HOME=" + fs.Path("install"),
+			})
+		})
+	}
+
+	t.Run("wrongChecksum", func(t *testing.T) {
+		tc, fs := givenInstallContext(t, installChecksumsCorrect)
+		tc.Setenv("MONGOD_WITH_SHELL", "1")
+		tc.HTTP().
+			GivenFixtureBody(shellFeedUrl, givenShellFeed(toolsArchive, "2.5.8")).
+			GivenFixtureBody("https://downloads.mongodb.com/compass/mongosh-2.5.8-linux-x64.tgz", shellArchive)
+		givenInstalledMongod(t, fs.Path("install"))
+
+		tc.ShouldEvaluateToError(t, `return PLUGIN:PostInstall({sdkInfo = {mongod = {path = [[`+fs.Path("install")+`]], version = "`+installVersion+`"}}})`, "Checksum mismatch of ")
+		assert.False(t, fs.Exists(filepath.Join("install", "mongosh")), "Unverified mongosh should not be installed.")
+		assert.False(t, fs.Exists(filepath.Join("install", "mongosh-2.5.8-linux-x64.tar.gz")), "Unverified archive should be removed.")
+	})
+}
+
+func TestCompanions___resolve_mirror(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/companions.lua")
+	tc.OsType = "linux"
+	tc.DistributionType = "ubuntu"
+	tc.DistributionVersion = "24.4"
+	tc.Setenv("MONGOD_SHELL_VERSIONS_URL", "https://mirror.example.com/mongodb/compass/mongosh.json")
+	tc.Setenv("MONGOD_TOOLS_VERSIONS_URL", "https://mirror.example.com/mongodb/tools/db/full.json")
+	tc.Setenv("MONGOD_DOWNLOAD_BASE_URL", "https://mirror.example.com/mongodb")
+	tc.HTTP().
+		GivenFixtureBody("https://mirror.example.com/mongodb/compass/mongosh.json", givenShellFeed(nil, "2.5.8")).
+		GivenFixtureBody("https://mirror.example.com/mongodb/tools/db/full.json", givenToolsFeed(nil, "100.13.0"))
+	tc.Setenv("MONGOD_WITH_SHELL", "1")
+	tc.Setenv("MONGOD_WITH_TOOLS", "1")
+
+	tc.ShouldEvaluateTo(t, `local result = {}
+for _, c in ipairs(t.requested()) do
+	table.insert(result, c.url)
+end
+return result`, []any{
+		"https://mirror.example.com/mongodb/compass/mongosh-2.5.8-linux-x64.tgz",
+		"https://mirror.example.com/mongodb/tools/db/mongodb-database-tools-ubuntu2404-x86_64-100.13.0.tgz",
+	})
+	tc.HTTP().ShouldOnlyHaveRequestedHosts(t, "mirror.example.com")
+}
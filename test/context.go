@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/echocat/slf4g"
 	"github.com/stretchr/testify/require"
@@ -22,16 +23,23 @@ var (
 )
 
 func GivenContext(t testing.TB) *Context {
+	t.Helper()
+	return GivenContextWithLimits(t, DefaultContextLimits)
+}
+
+// GivenContextWithLimits creates a Context like GivenContext, whose Lua code
+// is executed within the given limits.
+func GivenContextWithLimits(t testing.TB, limits ContextLimits) *Context {
 	t.Helper()
 	HookLogger(t)
 
-	c := NewContext()
+	c := NewContextWithLimits(limits)
 	t.Cleanup(c.Close)
+	t.Cleanup(func() {
+		c.HTTP().ShouldNotHaveViolatedLockdown(t)
+	})
 
-	c.L.PreloadModule("http", createContextHttpLoader())
-	c.L.PreloadModule("json", contextJsonLoader)
-
-	if err := c.PreLoadLibDir(DefaultLibPath); err != nil {
+	if err := c.PreloadModules(DefaultLibPath); err != nil {
 		t.Fatal(err)
 	}
 
@@ -41,45 +49,58 @@ func GivenContext(t testing.TB) *Context {
 func GivenContextWith(t testing.TB, luaFile string, otherModules ...string) *Context {
 	t.Helper()
 	c := GivenContext(t)
-	L := c.getL()
-
-	{
-		lf, err := L.LoadFile(luaFile)
-		if err != nil {
-			t.Fatalf("cannot load lua file %q: %v", luaFile, err)
-			return c
-		}
-
-		L.Push(lf)
-		L.Call(0, 1)
 
-		v := L.Get(-1)
-		L.SetGlobal("t", v)
+	if err := c.LoadGlobal("t", luaFile); err != nil {
+		t.Fatal(err)
+		return c
 	}
-
 	for _, om := range otherModules {
-		lf, err := L.LoadFile(om)
-		if err != nil {
-			t.Fatalf("cannot load lua file %q: %v", om, err)
+		omn := strings.TrimSuffix(filepath.Base(om), filepath.Ext(om))
+		if err := c.LoadGlobal(omn, om); err != nil {
+			t.Fatal(err)
 			return c
 		}
+	}
 
-		L.Push(lf)
-		L.Call(0, 1)
+	return c
+}
 
-		v := L.Get(-1)
-		omn := strings.TrimSuffix(filepath.Base(om), filepath.Ext(om))
-		L.SetGlobal(omn, v)
+// LoadGlobal executes the given Lua file and stores its result as global
+// with the given name.
+func (c *Context) LoadGlobal(name, luaFile string) error {
+	L := c.getL()
+	lf, err := c.loadFile(luaFile)
+	if err != nil {
+		return fmt.Errorf("cannot load lua file %q: %w", luaFile, err)
 	}
 
-	return c
+	L.Push(lf)
+	if err := L.PCall(0, 1, nil); err != nil {
+		return fmt.Errorf("cannot execute lua file %q: %w", luaFile, err)
+	}
+	L.SetGlobal(name, L.Get(-1))
+	L.Pop(1)
+
+	c.setup(func(c *Context) error {
+		return c.LoadGlobal(name, luaFile)
+	})
+	return nil
 }
 
 func NewContext() *Context {
-	L := lua.NewState()
+	return NewContextWithLimits(DefaultContextLimits)
+}
+
+// NewContextWithLimits creates a Context whose Lua code is executed within
+// the given limits.
+func NewContextWithLimits(limits ContextLimits) *Context {
+	L := lua.NewState(limits.options())
 
 	result := &Context{
 		L:        L,
+		Limits:   limits,
+		http:     newContextHttp(),
+		commands: &contextCommands{},
 		OsType:   "Windows",
 		ArchType: "amd64",
 	}
@@ -122,6 +143,11 @@ func NewContext() *Context {
 	L.SetMetatable(rt, mt)
 	L.SetGlobal("RUNTIME", rt)
 
+	result.http.env.getenv = result.Getenv
+	result.overrideOsModule()
+	result.overrideIoModule()
+	result.overridePrint()
+
 	return result
 }
 
@@ -134,6 +160,43 @@ type Context struct {
 
 	DistributionType    string
 	DistributionVersion string
+
+	// Limits of the execution of the Lua code. The call stack and registry
+	// sizes only take effect on creation (see NewContextWithLimits).
+	Limits ContextLimits
+
+	// Env overlays the environment variables of the process for os.getenv.
+	Env map[string]string
+
+	// IsolatedEnv hides the environment variables of the process, so
+	// os.getenv only sees Env.
+	IsolatedEnv bool
+
+	// Clock replaces the current time for os.time and os.date. If nil,
+	// time.Now is used.
+	Clock func() time.Time
+
+	http     *ContextHttp
+	commands *contextCommands
+	logs     contextLogs
+	setups   []func(*Context) error
+}
+
+// Evaluate executes the given Lua source and returns its (converted) result.
+func (c *Context) Evaluate(source string) (any, error) {
+	L := c.getL()
+	fn, err := L.LoadString(source)
+	if err != nil {
+		return nil, err
+	}
+
+	L.Push(fn)
+	if err := c.pcall(); err != nil {
+		return nil, err
+	}
+	defer L.Pop(1)
+
+	return c.ValueToAny(L.Get(-1))
 }
 
 func (c *Context) ShouldEvaluate(t testing.TB, source string) any {
@@ -143,7 +206,7 @@ func (c *Context) ShouldEvaluate(t testing.TB, source string) any {
 	require.NoError(t, err, "Evaluation of script should not fail.")
 
 	L.Push(fn)
-	err = L.PCall(0, 1, nil)
+	err = c.pcall()
 	require.NoError(t, err, "Execution of script should not fail.")
 
 	lCurrent := L.Get(-1)
@@ -168,7 +231,8 @@ func (c *Context) ShouldEvaluateToError(t testing.TB, source string, expectedErr
 	require.NoError(t, err, "Evaluation of script should not fail.")
 
 	L.Push(fn)
-	err = L.PCall(0, 1, nil)
+	err = c.pcall()
+	shouldNotExceedLimits(t, err)
 
 	tErr := err
 	var lae *lua.ApiError
@@ -179,6 +243,25 @@ func (c *Context) ShouldEvaluateToError(t testing.TB, source string, expectedErr
 	require.ErrorContains(t, tErr, expectedErrorContains, "Evaluation of %q should fail with an error containing %q", source, expectedErrorContains)
 }
 
+// PreloadModules preloads the http, json and log modules provided by this
+// Context and all modules of the given lib directory (see PreLoadLibDir).
+func (c *Context) PreloadModules(libPath string) error {
+	c.preloadProvidedModules()
+	return c.PreLoadLibDir(libPath)
+}
+
+func (c *Context) preloadProvidedModules() {
+	L := c.getL()
+	L.PreloadModule("http", c.HTTP().loader)
+	L.PreloadModule("json", contextJsonLoader)
+	L.PreloadModule("log", c.logLoader)
+
+	c.setup(func(c *Context) error {
+		c.preloadProvidedModules()
+		return nil
+	})
+}
+
 func (c *Context) PreLoadLibDir(path string) error {
 	if path == "" {
 		return fmt.Errorf("empty path")
@@ -197,7 +280,7 @@ func (c *Context) PreLoadLibDir(path string) error {
 		def := filepath.Join(path, den)
 		den = strings.TrimSuffix(den, filepath.Ext(den))
 		L.PreloadModule(den, func(L *lua.LState) int {
-			lf, err := L.LoadFile(def)
+			lf, err := c.loadFile(def)
 			logger := c.GetLogger().
 				With("module", den)
 			if err != nil {
@@ -213,9 +296,23 @@ func (c *Context) PreLoadLibDir(path string) error {
 		})
 	}
 
+	c.setup(func(c *Context) error {
+		return c.PreLoadLibDir(path)
+	})
 	return nil
 }
 
+// HTTP returns the http module which is provided to the Lua code.
+func (c *Context) HTTP() *ContextHttp {
+	if c == nil {
+		panic("nil context")
+	}
+	if v := c.http; v != nil {
+		return v
+	}
+	panic("context not initialized")
+}
+
 func (c *Context) GetLogger() log.Logger {
 	if c != nil {
 		if v := c.Logger; v != nil {
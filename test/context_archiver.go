@@ -0,0 +1,148 @@
+package test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// GivenMise makes the Lua code of this Context believe that it is executed
+// inside MISE by providing the archiver module, which only MISE provides
+// (see host.is_mise()).
+func (c *Context) GivenMise() *Context {
+	c.getL().PreloadModule("archiver", contextArchiverLoader)
+	c.setup(func(c *Context) error {
+		c.GivenMise()
+		return nil
+	})
+	return c
+}
+
+func contextArchiverLoader(L *lua.LState) int {
+	mod := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"decompress": contextArchiverDecompress,
+	})
+	L.Push(mod)
+	return 1
+}
+
+// decompress(archive, destination) extracts the given .tar.gz, .tgz or .zip
+// archive into destination and returns nil or an error message.
+func contextArchiverDecompress(L *lua.LState) int {
+	src := L.CheckString(1)
+	dst := L.CheckString(2)
+
+	var err error
+	switch {
+	case strings.HasSuffix(src, ".tar.gz"), strings.HasSuffix(src, ".tgz"):
+		err = decompressTarGz(src, dst)
+	case strings.HasSuffix(src, ".zip"):
+		err = decompressZip(src, dst)
+	default:
+		err = fmt.Errorf("unsupported archive format")
+	}
+	if err != nil {
+		L.Push(lua.LString(fmt.Sprintf("cannot decompress %s: %v", src, err)))
+		return 1
+	}
+	L.Push(lua.LNil)
+	return 1
+}
+
+func decompressTarGz(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := decompressTarget(dst, h.Name)
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := decompressFile(target, h.FileInfo().Mode(), tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func decompressZip(src, dst string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = zr.Close() }()
+
+	for _, f := range zr.File {
+		target, err := decompressTarget(dst, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = decompressFile(target, f.Mode(), r)
+		_ = r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decompressTarget(dst, name string) (string, error) {
+	result := filepath.Join(dst, name)
+	if result != filepath.Clean(dst) && !strings.HasPrefix(result, filepath.Clean(dst)+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal path inside archive: %s", name)
+	}
+	return result, nil
+}
+
+func decompressFile(target string, mode os.FileMode, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"sync"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// compiledLuaFiles caches the compiled FunctionProto of every Lua file which
+// was loaded by any Context (see loadFile). A FunctionProto is immutable, so
+// every LState can create its functions from the same one.
+var compiledLuaFiles sync.Map
+
+type compiledLuaFileKey struct {
+	path    string
+	size    int64
+	modTime int64
+}
+
+// compileLuaFile compiles the given Lua file or returns its FunctionProto
+// from compiledLuaFiles if the file did not change since then.
+func compileLuaFile(path string) (*lua.FunctionProto, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	key := compiledLuaFileKey{path, fi.Size(), fi.ModTime().UnixNano()}
+	if v, ok := compiledLuaFiles.Load(key); ok {
+		return v.(*lua.FunctionProto), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	// Like LState.LoadFile, ignore a shebang line.
+	reader := bufio.NewReader(f)
+	if first, err := reader.Peek(1); err == nil && first[0] == '#' {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	chunk, err := parse.Parse(reader, path)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := lua.Compile(chunk, path)
+	if err != nil {
+		return nil, err
+	}
+	compiledLuaFiles.Store(key, proto)
+	return proto, nil
+}
+
+// loadFile returns the function of the given Lua file (like LState.LoadFile)
+// without compiling it again (see compileLuaFile).
+func (c *Context) loadFile(path string) (*lua.LFunction, error) {
+	proto, err := compileLuaFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.getL().NewFunctionFromProto(proto), nil
+}
+
+// doFile executes the given Lua file (like LState.DoFile).
+func (c *Context) doFile(path string) error {
+	fn, err := c.loadFile(path)
+	if err != nil {
+		return err
+	}
+	L := c.getL()
+	L.Push(fn)
+	return L.PCall(0, lua.MultRet, nil)
+}
+
+// setup records the given step of the setup of this Context (like
+// PreloadModules or LoadPlugin) to replay it on every Clone.
+func (c *Context) setup(step func(*Context) error) {
+	c.setups = append(c.setups, step)
+}
+
+// Clone creates a new Context with a fresh LState, which is set up like this
+// one: it has the same preloaded modules, lib directory, loaded files and
+// plugin, limits, runtime, logger, environment, clock, intercepted commands
+// and HTTP fixtures, faults and transport. Executed commands, requests and
+// logs are not carried over. Changes of one Context (including the global
+// state of its Lua code) never affect the other.
+//
+// Keep in mind that a Filesystem (see GivenFilesystem) is shared by both as
+// they share the environment; call GivenFilesystem on the clone to isolate
+// it.
+func (c *Context) Clone() (*Context, error) {
+	result := NewContextWithLimits(c.Limits)
+	result.Logger = c.Logger
+	result.OsType = c.OsType
+	result.ArchType = c.ArchType
+	result.DistributionType = c.DistributionType
+	result.DistributionVersion = c.DistributionVersion
+	result.Env = maps.Clone(c.Env)
+	result.IsolatedEnv = c.IsolatedEnv
+	result.Clock = c.Clock
+
+	c.commands.mutex.Lock()
+	result.commands.handlers = append([]contextCommand(nil), c.commands.handlers...)
+	c.commands.mutex.Unlock()
+
+	c.http.cloneInto(result.http)
+
+	for _, step := range c.setups {
+		if err := step(result); err != nil {
+			result.Close()
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// GivenClone creates a Clone of this Context for the given test, which is
+// closed (and checked for lockdown violations) once the test is done. Each
+// parallel subtest should use its own clone.
+func (c *Context) GivenClone(t testing.TB) *Context {
+	t.Helper()
+	result, err := c.Clone()
+	if err != nil {
+		t.Fatalf("cannot clone context: %v", err)
+	}
+	t.Cleanup(result.Close)
+	t.Cleanup(func() {
+		result.HTTP().ShouldNotHaveViolatedLockdown(t)
+	})
+	return result
+}
+
+func (m *ContextHttp) cloneInto(target *ContextHttp) {
+	target.transport = m.transport
+
+	m.fixtures.mutex.Lock()
+	target.fixtures.handlers = maps.Clone(m.fixtures.handlers)
+	m.fixtures.mutex.Unlock()
+
+	m.faults.mutex.Lock()
+	for _, f := range m.faults.entries {
+		target.faults.entries = append(target.faults.entries, &contextHttpFault{url: f.url, HttpFault: f.HttpFault})
+	}
+	m.faults.mutex.Unlock()
+
+	m.lockdown.mutex.Lock()
+	target.lockdown.allowNetwork = m.lockdown.allowNetwork
+	m.lockdown.mutex.Unlock()
+}
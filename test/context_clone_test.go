@@ -0,0 +1,121 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_Clone(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/host.lua").GivenMise()
+	tc.Setenv("MONGOD_EDITION", "enterprise")
+	tc.GivenCommandOutput(`^mongod --version`, "db version v8.0.9", 0)
+	tc.HTTP().GivenFixtureBody("https://downloads.mongodb.org/full.json", []byte(`{"versions":[]}`))
+	tc.ShouldEvaluateTo(t, `marker = "original"
+t.marker = "original"
+return nil`, nil)
+	tc.ShouldEvaluateTo(t, `local handle = io.popen("mongod --version")
+local output = handle:read("*a")
+handle:close()
+print(output)
+return nil`, nil)
+
+	clone := tc.GivenClone(t)
+
+	t.Run("keepsSetup", func(t *testing.T) {
+		clone.ShouldEvaluateTo(t, `return t.is_mise()`, true)
+		clone.ShouldEvaluateTo(t, `return type(require("host").is_mise)`, "function")
+		clone.ShouldEvaluateTo(t, `return os.getenv("MONGOD_EDITION")`, "enterprise")
+		clone.ShouldEvaluateTo(t, `local handle = io.popen("mongod --version")
+local output = handle:read("*a")
+handle:close()
+return output`, "db version v8.0.9")
+		clone.ShouldEvaluateTo(t, `local resp, err = require("http").get({url = "https://downloads.mongodb.org/full.json"})
+return resp and resp.body or err`, `{"versions":[]}`)
+		assert.Equal(t, tc.Limits, clone.Limits)
+	})
+	t.Run("isolatesState", func(t *testing.T) {
+		clone.ShouldEvaluateTo(t, `return marker`, nil)
+		clone.ShouldEvaluateTo(t, `return t.marker`, nil)
+
+		clone.Setenv("MONGOD_EDITION", "community")
+		clone.ShouldEvaluateTo(t, `marker = "clone"
+return nil`, nil)
+		tc.ShouldEvaluateTo(t, `return os.getenv("MONGOD_EDITION")`, "enterprise")
+		tc.ShouldEvaluateTo(t, `return marker`, "original")
+	})
+	t.Run("forgetsRecords", func(t *testing.T) {
+		assert.Equal(t, []string{"mongod --version"}, clone.Commands())
+		assert.Len(t, tc.Commands(), 1)
+		assert.Empty(t, clone.LogsMatching("db version v8.0.9"))
+		assert.Len(t, tc.LogsMatching("db version v8.0.9"), 1)
+		clone.HTTP().ShouldHaveRequested(t, "https://downloads.mongodb.org/full.json", 1)
+		tc.HTTP().ShouldHaveRequested(t, "https://downloads.mongodb.org/full.json", 0)
+	})
+}
+
+func TestContext_Clone_plugin(t *testing.T) {
+	tc := GivenPluginContext(t)
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			tc := tc.GivenClone(t)
+
+			tc.ShouldEvaluateTo(t, `return PLUGIN.name`, "mongod")
+			tc.ShouldEvaluateTo(t, `PLUGIN.name = "`+name+`"
+return PLUGIN.name`, name)
+		})
+	}
+
+	tc.ShouldEvaluateTo(t, `return PLUGIN.name`, "mongod")
+}
+
+func TestContext_Clone_limits(t *testing.T) {
+	tc := GivenContextWithLimits(t, ContextLimits{Timeout: 50 * time.Millisecond})
+	clone := tc.GivenClone(t)
+
+	_, err := clone.Evaluate(`while true do end`)
+	var le *LimitError
+	require.ErrorAs(t, err, &le)
+	assert.Equal(t, "timeout", le.Limit)
+}
+
+func TestCompileLuaFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "answer.lua")
+	require.NoError(t, os.WriteFile(fn, []byte("#!/usr/bin/env lua\nreturn 42\n"), 0644))
+
+	first, err := compileLuaFile(fn)
+	require.NoError(t, err)
+	second, err := compileLuaFile(fn)
+	require.NoError(t, err)
+	assert.Same(t, first, second, "Unchanged file should not be compiled again.")
+
+	require.NoError(t, os.WriteFile(fn, []byte("return 4242\n"), 0644))
+	require.NoError(t, os.Chtimes(fn, time.Now(), time.Now().Add(time.Second)))
+	third, err := compileLuaFile(fn)
+	require.NoError(t, err)
+	assert.NotSame(t, first, third, "Changed file should be compiled again.")
+
+	tc := GivenContext(t)
+	fnc, err := tc.loadFile(fn)
+	require.NoError(t, err)
+	tc.getL().Push(fnc)
+	require.NoError(t, tc.getL().PCall(0, 1, nil))
+	assert.Equal(t, "4242", tc.getL().Get(-1).String())
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := compileLuaFile(filepath.Join(t.TempDir(), "missing.lua"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+	t.Run("illegal", func(t *testing.T) {
+		fn := filepath.Join(t.TempDir(), "illegal.lua")
+		require.NoError(t, os.WriteFile(fn, []byte("return ("), 0644))
+		_, err := compileLuaFile(fn)
+		assert.ErrorContains(t, err, fn)
+	})
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// CommandHandler answers an intercepted command (see GivenCommand) with its
+// combined output and its exit code.
+type CommandHandler func(command string) (output string, exitCode int)
+
+// GivenCommand intercepts every command which the Lua code executes via
+// io.popen and which matches the given regular expression; instead of
+// executing it, the given handler answers it. Later registered commands take
+// precedence. Commands which are not intercepted are executed as usual.
+func (c *Context) GivenCommand(pattern string, handler CommandHandler) *Context {
+	c.commands.add(regexp.MustCompile(pattern), handler)
+	return c
+}
+
+// GivenCommandOutput intercepts every command which matches the given
+// regular expression (see GivenCommand) and answers it with the given output
+// and exit code.
+func (c *Context) GivenCommandOutput(pattern string, output string, exitCode int) *Context {
+	return c.GivenCommand(pattern, func(string) (string, int) {
+		return output, exitCode
+	})
+}
+
+// Commands returns every command which was executed via io.popen so far
+// (intercepted or not) in the order of its execution.
+func (c *Context) Commands() []string {
+	return c.commands.all()
+}
+
+// CommandsMatching returns every command of Commands which matches the given
+// regular expression.
+func (c *Context) CommandsMatching(pattern string) []string {
+	r := regexp.MustCompile(pattern)
+	var result []string
+	for _, command := range c.Commands() {
+		if r.MatchString(command) {
+			result = append(result, command)
+		}
+	}
+	return result
+}
+
+// ResetCommands forgets all executed commands.
+func (c *Context) ResetCommands() {
+	c.commands.reset()
+}
+
+// ShouldHaveExecuted asserts that the given commands were executed in the
+// given order (other commands in between are ignored).
+func (c *Context) ShouldHaveExecuted(t testing.TB, expected ...string) {
+	t.Helper()
+	actual := c.Commands()
+	i := 0
+	for _, command := range actual {
+		if i < len(expected) && command == expected[i] {
+			i++
+		}
+	}
+	require.Equal(t, len(expected), i, "Should have executed %q in this order; but executed: %q", expected, actual)
+}
+
+type contextCommand struct {
+	pattern *regexp.Regexp
+	handler CommandHandler
+}
+
+type contextCommands struct {
+	mutex    sync.Mutex
+	handlers []contextCommand
+	executed []string
+}
+
+func (cs *contextCommands) add(pattern *regexp.Regexp, handler CommandHandler) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.handlers = append(cs.handlers, contextCommand{pattern, handler})
+}
+
+func (cs *contextCommands) record(command string) CommandHandler {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.executed = append(cs.executed, command)
+	for i := len(cs.handlers) - 1; i >= 0; i-- {
+		if cs.handlers[i].pattern.MatchString(command) {
+			return cs.handlers[i].handler
+		}
+	}
+	return nil
+}
+
+func (cs *contextCommands) all() []string {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return append([]string(nil), cs.executed...)
+}
+
+func (cs *contextCommands) reset() {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.executed = nil
+}
+
+// overrideIoModule routes io.popen through the intercepted commands of this
+// Context (see GivenCommand).
+func (c *Context) overrideIoModule() {
+	L := c.getL()
+	iom, ok := L.GetGlobal("io").(*lua.LTable)
+	if !ok {
+		return
+	}
+	origPopen := iom.RawGetString("popen")
+
+	L.SetField(iom, "popen", L.NewFunction(func(L *lua.LState) int {
+		command := L.CheckString(1)
+		handler := c.commands.record(command)
+		if handler == nil {
+			top := L.GetTop()
+			mode := L.OptString(2, "r")
+			L.Push(origPopen)
+			L.Push(lua.LString(command))
+			L.Push(lua.LString(mode))
+			L.Call(2, lua.MultRet)
+			return L.GetTop() - top
+		}
+
+		output, exitCode := handler(command)
+		L.Push(c.newInterceptedProcess(output, exitCode))
+		return 1
+	}))
+}
+
+// newInterceptedProcess creates a handle like io.popen returns one, which
+// provides the given output and exit code.
+func (c *Context) newInterceptedProcess(output string, exitCode int) *lua.LTable {
+	L := c.getL()
+	result := L.NewTable()
+	L.SetFuncs(result, map[string]lua.LGFunction{
+		"read": func(L *lua.LState) int {
+			L.Push(lua.LString(output))
+			output = ""
+			return 1
+		},
+		"close": func(L *lua.LState) int {
+			L.Push(lua.LNumber(exitCode))
+			return 1
+		},
+	})
+	return result
+}
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Filesystem is a sandbox inside a temporary directory which contains the
+// home and cache directories of a Context.
+type Filesystem struct {
+	Root string
+}
+
+// GivenFilesystem creates a new Filesystem and points HOME and every cache
+// directory of vfox and MISE of this Context into it.
+func (c *Context) GivenFilesystem(t testing.TB) *Filesystem {
+	t.Helper()
+	result := &Filesystem{Root: t.TempDir()}
+
+	c.Setenv("HOME", result.Path("home"))
+	c.Setenv("USERPROFILE", result.Path("home"))
+	c.Setenv("XDG_CACHE_HOME", result.Path("home", ".cache"))
+	c.Setenv("VFOX_HOME", result.Path("home", ".version-fox"))
+	c.Setenv("VFOX_CACHE", result.Path("vfox-cache"))
+	c.Setenv("MISE_CACHE_DIR", result.Path("mise-cache"))
+
+	return result
+}
+
+// Path returns the absolute path of the given path elements inside this
+// Filesystem.
+func (fs *Filesystem) Path(elem ...string) string {
+	return filepath.Join(append([]string{fs.Root}, elem...)...)
+}
+
+// CacheDir returns the cache directory of the plugin as it is used by vfox
+// (see host.cache_dir()).
+func (fs *Filesystem) CacheDir() string {
+	return fs.Path("vfox-cache", "echocat-vfox-mongod")
+}
+
+func (fs *Filesystem) ShouldWriteFile(t testing.TB, path string, content string) {
+	t.Helper()
+	fn := fs.Path(path)
+	require.NoError(t, os.MkdirAll(filepath.Dir(fn), 0700), "Should create parent of %s.", fn)
+	require.NoError(t, os.WriteFile(fn, []byte(content), 0600), "Should write %s.", fn)
+}
+
+func (fs *Filesystem) ShouldReadFile(t testing.TB, path string) string {
+	t.Helper()
+	fn := fs.Path(path)
+	content, err := os.ReadFile(fn)
+	require.NoError(t, err, "Should read %s.", fn)
+	return string(content)
+}
+
+func (fs *Filesystem) Exists(path string) bool {
+	_, err := os.Stat(fs.Path(path))
+	return err == nil
+}
@@ -1,89 +1,324 @@
 package test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	log "github.com/echocat/slf4g"
 	lua "github.com/yuin/gopher-lua"
 )
 
-type contextHttp struct{}
+const defaultMaxRedirects = 10
 
-func (m *contextHttp) get(L *lua.LState) int {
+// ContextHttp is the http module which is provided to the Lua code of a
+// Context.
+type ContextHttp struct {
+	transport http.RoundTripper
+	env       contextHttpTransport
+	faults    contextHttpFaults
+	recorder  contextHttpRecorder
+	fixtures  contextHttpFixtures
+	lockdown  contextHttpLockdown
+}
+
+func newContextHttp() *ContextHttp {
+	return &ContextHttp{}
+}
+
+type contextHttpRequest struct {
+	*http.Request
+	followRedirects bool
+	maxRedirects    int
+	timeout         time.Duration
+}
+
+func (m *ContextHttp) get(L *lua.LState) int {
+	req, err := m.newRequest(L, http.MethodGet)
+	if err != nil {
+		return m.pushError(L, err)
+	}
+
+	resp, body, err := m.do(req, true)
+	if err != nil {
+		return m.pushError(L, err)
+	}
+
+	result := m.newResponseTable(L, resp)
+	L.SetField(result, "body", lua.LString(body))
+	L.Push(result)
+	return 1
+}
+
+func (m *ContextHttp) head(L *lua.LState) int {
+	req, err := m.newRequest(L, http.MethodHead)
+	if err != nil {
+		return m.pushError(L, err)
+	}
+
+	resp, _, err := m.do(req, false)
+	if err != nil {
+		return m.pushError(L, err)
+	}
+
+	L.Push(m.newResponseTable(L, resp))
+	return 1
+}
+
+func (m *ContextHttp) downloadFile(L *lua.LState) int {
+	req, err := m.newRequest(L, http.MethodGet)
+	if err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+	fn := L.CheckString(2)
+
+	if err := m.download(req, fn); err != nil {
+		L.Push(lua.LString(err.Error()))
+		return 1
+	}
+
+	L.Push(lua.LNil)
+	return 1
+}
+
+func (m *ContextHttp) newRequest(L *lua.LState, method string) (*contextHttpRequest, error) {
 	param := L.CheckTable(1)
 	urlStr := param.RawGetString("url")
 	if urlStr == lua.LNil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString("url is required"))
-		return 2
+		return nil, errors.New("url is required")
 	}
 
-	req, err := http.NewRequest("GET", urlStr.String(), nil)
+	// The context of the LState carries the timeout of the evaluation (see
+	// ContextLimits).
+	ctx := L.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = withCallSite(ctx, strings.TrimSuffix(L.Where(1), ":"))
+	req, err := http.NewRequestWithContext(ctx, method, urlStr.String(), nil)
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return nil, err
 	}
 
 	headersTable := param.RawGetString("headers")
 	if headersTable != lua.LNil {
 		if table, ok := headersTable.(*lua.LTable); ok {
 			table.ForEach(func(key lua.LValue, value lua.LValue) {
+				if values, ok := value.(*lua.LTable); ok {
+					values.ForEach(func(_ lua.LValue, v lua.LValue) {
+						req.Header.Add(key.String(), v.String())
+					})
+					return
+				}
 				req.Header.Add(key.String(), value.String())
 			})
 		}
 	}
 
+	result := &contextHttpRequest{
+		Request:         req,
+		followRedirects: true,
+		maxRedirects:    defaultMaxRedirects,
+	}
+
+	switch v := param.RawGetString("follow_redirects").(type) {
+	case *lua.LNilType:
+	case lua.LBool:
+		result.followRedirects = bool(v)
+	default:
+		return nil, fmt.Errorf("follow_redirects needs to be a boolean; but got: %s", v.Type())
+	}
+
+	switch v := param.RawGetString("max_redirects").(type) {
+	case *lua.LNilType:
+	case lua.LNumber:
+		result.maxRedirects = int(v)
+	default:
+		return nil, fmt.Errorf("max_redirects needs to be a number; but got: %s", v.Type())
+	}
+
+	switch v := param.RawGetString("timeout").(type) {
+	case *lua.LNilType:
+	case lua.LNumber:
+		result.timeout = time.Duration(float64(v) * float64(time.Second))
+	default:
+		return nil, fmt.Errorf("timeout needs to be a number of seconds; but got: %s", v.Type())
+	}
+
+	return result, nil
+}
+
+func (m *ContextHttp) client(req *contextHttpRequest) (*http.Client, error) {
+	transport, proxyOf := m.transport, func(*http.Request) (*url.URL, error) { return nil, nil }
+	if transport == nil {
+		var err error
+		if transport, err = m.env.get(); err != nil {
+			return nil, err
+		}
+		proxyOf = m.env.proxyOf
+	}
+	return &http.Client{
+		Transport: &recordingTransport{
+			delegate: &faultTransport{
+				delegate: &fixtureTransport{
+					delegate: &lockdownTransport{
+						delegate: transport,
+						lockdown: &m.lockdown,
+						proxyOf:  proxyOf,
+					},
+					fixtures: &m.fixtures,
+				},
+				faults: &m.faults,
+			},
+			recorder: &m.recorder,
+		},
+		Timeout: req.timeout,
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			if !req.followRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > req.maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", req.maxRedirects)
+			}
+			return nil
+		},
+	}, nil
+}
+
+func (m *ContextHttp) do(req *contextHttpRequest, readBody bool) (*http.Response, []byte, error) {
 	start := time.Now()
-	logger := log.With("url", urlStr).
-		With("method", "GET")
+	logger := log.With("url", req.URL.String()).
+		With("method", req.Method)
 
 	logger.Debug("Executing HTTP request...")
-	resp, err := http.DefaultClient.Do(req)
+	client, err := m.client(req)
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return nil, nil, err
+	}
+	resp, err := client.Do(req.Request)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
-	headers := L.NewTable()
-	for k, v := range resp.Header {
-		if len(v) > 0 {
-			headers.RawSetString(k, lua.LString(v[0]))
+
+	var body []byte
+	if readBody {
+		if body, err = io.ReadAll(resp.Body); err != nil {
+			return nil, nil, err
 		}
 	}
-	body, err := io.ReadAll(resp.Body)
+
+	logger.
+		With("status", resp.StatusCode).
+		With("duration", time.Since(start).Truncate(time.Millisecond).String()).
+		Debug("Executing HTTP request... DONE!")
+
+	return resp, body, nil
+}
+
+func (m *ContextHttp) download(req *contextHttpRequest, fn string) error {
+	start := time.Now()
+	logger := log.With("url", req.URL.String()).
+		With("method", req.Method).
+		With("file", fn)
+
+	logger.Debug("Downloading file...")
+	client, err := m.client(req)
 	if err != nil {
-		L.Push(lua.LNil)
-		L.Push(lua.LString(err.Error()))
-		return 2
+		return err
+	}
+	resp, err := client.Do(req.Request)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download of %s failed with status %d", req.URL, resp.StatusCode)
+	}
+
+	// Download into a temporary file first, so a failed download never
+	// leaves a truncated file at fn which looks like a finished one.
+	f, err := os.CreateTemp(filepath.Dir(fn), filepath.Base(fn)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	n, err := io.Copy(f, resp.Body)
+	if err != nil {
+		return fmt.Errorf("download of %s failed: %w", req.URL, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), fn); err != nil {
+		return err
 	}
-	result := L.NewTable()
-	L.SetField(result, "body", lua.LString(body))
-	L.SetField(result, "status_code", lua.LNumber(resp.StatusCode))
-	L.SetField(result, "headers", headers)
-	L.SetField(result, "content_length", lua.LNumber(resp.ContentLength))
-	L.Push(result)
 
 	logger.
+		With("bytes", n).
 		With("duration", time.Since(start).Truncate(time.Millisecond).String()).
-		Debug("Executing HTTP request... DONE!")
+		Debug("Downloading file... DONE!")
 
-	return 1
+	return nil
 }
 
-func createContextHttpLoader() lua.LGFunction {
-	return func(L *lua.LState) int {
-		m := &contextHttp{}
-		t := L.NewTable()
-		L.SetFuncs(t, map[string]lua.LGFunction{
-			"get": m.get,
-		})
-		L.Push(t)
-		return 1
+// newResponseTable creates the vfox compatible response table. Like vfox,
+// headers contains only the first value of each header as string; the
+// additional headers_all contains all values of each header as array of
+// strings, for tests which need to check headers which occur multiple times.
+func (m *ContextHttp) newResponseTable(L *lua.LState, resp *http.Response) *lua.LTable {
+	headers, headersAll := L.NewTable(), L.NewTable()
+	for k, v := range resp.Header {
+		if len(v) == 0 {
+			continue
+		}
+		headers.RawSetString(k, lua.LString(v[0]))
+		values := L.CreateTable(len(v), 0)
+		for _, cv := range v {
+			values.Append(lua.LString(cv))
+		}
+		headersAll.RawSetString(k, values)
 	}
+
+	result := L.NewTable()
+	L.SetField(result, "status_code", lua.LNumber(resp.StatusCode))
+	L.SetField(result, "headers", headers)
+	L.SetField(result, "headers_all", headersAll)
+	L.SetField(result, "content_length", lua.LNumber(resp.ContentLength))
+	L.SetField(result, "final_url", lua.LString(resp.Request.URL.String()))
+	return result
+}
+
+func (m *ContextHttp) pushError(L *lua.LState, err error) int {
+	L.Push(lua.LNil)
+	L.Push(lua.LString(err.Error()))
+	return 2
+}
+
+func (m *ContextHttp) loader(L *lua.LState) int {
+	t := L.NewTable()
+	L.SetFuncs(t, map[string]lua.LGFunction{
+		"get":           m.get,
+		"head":          m.head,
+		"download_file": m.downloadFile,
+	})
+	L.Push(t)
+	return 1
 }
@@ -0,0 +1,198 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// AnyUrl can be used as url of ContextHttp.GivenFault to apply a fault to
+// every request.
+const AnyUrl = ""
+
+// HttpFault describes how a request should misbehave. Everything which is
+// not set behaves as usual.
+type HttpFault struct {
+	// Latency delays the request before it is executed.
+	Latency time.Duration
+
+	// Timeout makes the request fail with a timeout error.
+	Timeout bool
+
+	// Reset makes the request fail as if the connection was reset by the
+	// peer.
+	Reset bool
+
+	// StatusCode replaces the response with one with this status code. If
+	// Body is not set, the body is the status text of this code.
+	StatusCode int
+
+	// Body replaces the response body. If StatusCode is not set, 200 is used.
+	Body []byte
+
+	// TruncateBodyAfter makes the reading of the response body fail with
+	// io.ErrUnexpectedEOF after the given amount of bytes. Values <= 0
+	// disable the truncation.
+	TruncateBodyAfter int
+
+	// Times limits how often the fault is applied. After it was applied the
+	// given number of times, the requests behave as usual again. 0 applies
+	// the fault forever.
+	Times int
+}
+
+// GivenFault registers a fault for every request to the given url (see
+// AnyUrl). Faults which are registered later take precedence.
+func (m *ContextHttp) GivenFault(url string, fault HttpFault) *ContextHttp {
+	m.faults.add(url, fault)
+	return m
+}
+
+// ResetFaults removes every registered fault.
+func (m *ContextHttp) ResetFaults() *ContextHttp {
+	m.faults.reset()
+	return m
+}
+
+type contextHttpFaults struct {
+	mutex   sync.Mutex
+	entries []*contextHttpFault
+}
+
+type contextHttpFault struct {
+	url     string
+	applied int
+	HttpFault
+}
+
+func (f *contextHttpFaults) add(url string, fault HttpFault) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.entries = append(f.entries, &contextHttpFault{url: url, HttpFault: fault})
+}
+
+func (f *contextHttpFaults) reset() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.entries = nil
+}
+
+// take returns the latest registered fault which matches the given url and
+// is not yet exhausted.
+func (f *contextHttpFaults) take(url string) (HttpFault, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for i := len(f.entries) - 1; i >= 0; i-- {
+		candidate := f.entries[i]
+		if candidate.url != AnyUrl && candidate.url != url {
+			continue
+		}
+		if candidate.Times > 0 && candidate.applied >= candidate.Times {
+			continue
+		}
+		candidate.applied++
+		return candidate.HttpFault, true
+	}
+	return HttpFault{}, false
+}
+
+type faultTransport struct {
+	delegate http.RoundTripper
+	faults   *contextHttpFaults
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault, ok := t.faults.take(req.URL.String())
+	if !ok {
+		return t.delegate.RoundTrip(req)
+	}
+
+	if fault.Latency > 0 {
+		select {
+		case <-time.After(fault.Latency):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	if fault.Timeout {
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: errFaultTimeout}
+	}
+	if fault.Reset {
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	}
+
+	var resp *http.Response
+	if fault.StatusCode != 0 || fault.Body != nil {
+		resp = newFaultResponse(req, fault)
+	} else {
+		var err error
+		if resp, err = t.delegate.RoundTrip(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if fault.TruncateBodyAfter > 0 {
+		resp.Body = &truncatedBody{
+			ReadCloser: resp.Body,
+			remaining:  fault.TruncateBodyAfter,
+		}
+	}
+
+	return resp, nil
+}
+
+func newFaultResponse(req *http.Request, fault HttpFault) *http.Response {
+	statusCode := fault.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	body := fault.Body
+	if body == nil {
+		body = []byte(http.StatusText(statusCode))
+	}
+	header := http.Header{}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if len(p) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= n
+	return n, err
+}
+
+var errFaultTimeout error = faultTimeoutError{}
+
+type faultTimeoutError struct{}
+
+func (faultTimeoutError) Error() string   { return "i/o timeout" }
+func (faultTimeoutError) Timeout() bool   { return true }
+func (faultTimeoutError) Temporary() bool { return true }
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"time"
+)
+
+// GivenFixture serves every request to the given url by the given handler
+// without touching the network.
+func (m *ContextHttp) GivenFixture(url string, handler http.Handler) *ContextHttp {
+	m.fixtures.add(url, handler)
+	return m
+}
+
+// GivenFixtureBody serves every GET request to the given url with the given
+// body without touching the network.
+func (m *ContextHttp) GivenFixtureBody(url string, body []byte) *ContextHttp {
+	return m.GivenFixture(url, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+}
+
+// GivenFixtureContent serves every GET and HEAD request to the given url with
+// the given body, ETag (if not empty) and Last-Modified (if not zero) headers.
+// Conditional requests (If-None-Match, If-Modified-Since) are answered with
+// 304 Not Modified if they match.
+func (m *ContextHttp) GivenFixtureContent(url string, etag string, lastModified time.Time, body []byte) *ContextHttp {
+	return m.GivenFixture(url, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		http.ServeContent(w, r, path.Base(r.URL.Path), lastModified, bytes.NewReader(body))
+	}))
+}
+
+type contextHttpFixtures struct {
+	mutex    sync.Mutex
+	handlers map[string]http.Handler
+}
+
+func (f *contextHttpFixtures) add(url string, handler http.Handler) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.handlers == nil {
+		f.handlers = make(map[string]http.Handler)
+	}
+	f.handlers[url] = handler
+}
+
+func (f *contextHttpFixtures) get(url string) (http.Handler, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	handler, ok := f.handlers[url]
+	return handler, ok
+}
+
+type fixtureTransport struct {
+	delegate http.RoundTripper
+	fixtures *contextHttpFixtures
+}
+
+func (t *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	handler, ok := t.fixtures.get(req.URL.String())
+	if !ok {
+		return t.delegate.RoundTrip(req)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
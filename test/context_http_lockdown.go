@@ -0,0 +1,115 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// AllowNetwork disables the network lockdown. By default, the http module of
+// a Context only reaches loopback hosts and registered fixtures (see
+// GivenFixture) or faults which replace the response (see GivenFault). A
+// request through a proxy (see HTTP_PROXY) is checked for the host of the
+// proxy, as this is where the connection goes to. Only external tests should
+// call this.
+func (m *ContextHttp) AllowNetwork() *ContextHttp {
+	m.lockdown.mutex.Lock()
+	defer m.lockdown.mutex.Unlock()
+	m.lockdown.allowNetwork = true
+	return m
+}
+
+// ShouldNotHaveViolatedLockdown fails the given test for every request which
+// was rejected by the network lockdown.
+func (m *ContextHttp) ShouldNotHaveViolatedLockdown(t testing.TB) {
+	t.Helper()
+	for _, violation := range m.lockdown.all() {
+		t.Errorf("%v", violation)
+	}
+}
+
+// TakeLockdownViolations returns every request which was rejected by the
+// network lockdown so far and forgets them; they will no longer fail the test.
+func (m *ContextHttp) TakeLockdownViolations() []error {
+	return m.lockdown.take()
+}
+
+type contextHttpLockdown struct {
+	mutex        sync.Mutex
+	allowNetwork bool
+	violations   []error
+}
+
+func (l *contextHttpLockdown) check(req *http.Request, proxy *url.URL) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	host, via := req.URL.Hostname(), ""
+	if proxy != nil {
+		host, via = proxy.Hostname(), " via proxy "+proxy.Host
+	}
+	if l.allowNetwork || isLoopbackHost(host) {
+		return nil
+	}
+
+	callSite := callSiteOf(req.Context())
+	if callSite == "" {
+		callSite = "<unknown>"
+	}
+	err := fmt.Errorf("network lockdown: request to %s%s (called at %s) is not allowed; register a fixture or allow the network for external tests", req.URL, via, callSite)
+	l.violations = append(l.violations, err)
+	return err
+}
+
+func (l *contextHttpLockdown) all() []error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]error(nil), l.violations...)
+}
+
+func (l *contextHttpLockdown) take() []error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	result := l.violations
+	l.violations = nil
+	return result
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+type callSiteKey struct{}
+
+func withCallSite(ctx context.Context, callSite string) context.Context {
+	return context.WithValue(ctx, callSiteKey{}, callSite)
+}
+
+func callSiteOf(ctx context.Context) string {
+	v, _ := ctx.Value(callSiteKey{}).(string)
+	return v
+}
+
+type lockdownTransport struct {
+	delegate http.RoundTripper
+	lockdown *contextHttpLockdown
+	proxyOf  func(*http.Request) (*url.URL, error)
+}
+
+func (t *lockdownTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxy, err := t.proxyOf(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.lockdown.check(req, proxy); err != nil {
+		return nil, err
+	}
+	return t.delegate.RoundTrip(req)
+}
@@ -0,0 +1,143 @@
+package test
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// HttpRequestRecord is one request which was executed by the http module of a
+// Context. Every hop of a redirect is recorded as an own request.
+type HttpRequestRecord struct {
+	Method   string
+	Url      string
+	Host     string
+	Header   http.Header
+	Duration time.Duration
+
+	// StatusCode is 0 if the request failed; see Err.
+	StatusCode int
+	Err        error
+}
+
+// Requests returns all requests executed so far, in the order they were
+// started.
+func (m *ContextHttp) Requests() []HttpRequestRecord {
+	return m.recorder.all()
+}
+
+// RequestsOf returns all requests executed so far to the given url.
+func (m *ContextHttp) RequestsOf(url string) []HttpRequestRecord {
+	var result []HttpRequestRecord
+	for _, r := range m.recorder.all() {
+		if r.Url == url {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// ResetRequests forgets all requests executed so far.
+func (m *ContextHttp) ResetRequests() *ContextHttp {
+	m.recorder.reset()
+	return m
+}
+
+func (m *ContextHttp) ShouldHaveRequested(t testing.TB, url string, times int) []HttpRequestRecord {
+	t.Helper()
+	actual := m.RequestsOf(url)
+	require.Len(t, actual, times, "%s should be requested %d times; but was requested %d times.", url, times, len(actual))
+	return actual
+}
+
+func (m *ContextHttp) ShouldNotHaveRequested(t testing.TB, url string) {
+	t.Helper()
+	m.ShouldHaveRequested(t, url, 0)
+}
+
+// ShouldOnlyHaveRequestedHosts asserts that no other hosts than the given
+// ones (like "downloads.mongodb.org" or "127.0.0.1:1234") were requested.
+func (m *ContextHttp) ShouldOnlyHaveRequestedHosts(t testing.TB, hosts ...string) {
+	t.Helper()
+	expected := make(map[string]struct{}, len(hosts))
+	for _, host := range hosts {
+		expected[host] = struct{}{}
+	}
+
+	unexpected := map[string]struct{}{}
+	for _, r := range m.recorder.all() {
+		if _, ok := expected[r.Host]; !ok {
+			unexpected[r.Host] = struct{}{}
+		}
+	}
+
+	if len(unexpected) > 0 {
+		actual := make([]string, 0, len(unexpected))
+		for host := range unexpected {
+			actual = append(actual, host)
+		}
+		sort.Strings(actual)
+		require.Fail(t, "Unexpected hosts requested.", "Only %v should be requested; but also %v was requested.", hosts, actual)
+	}
+}
+
+type contextHttpRecorder struct {
+	mutex   sync.Mutex
+	records []*HttpRequestRecord
+}
+
+func (r *contextHttpRecorder) all() []HttpRequestRecord {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	result := make([]HttpRequestRecord, len(r.records))
+	for i, record := range r.records {
+		result[i] = *record
+	}
+	return result
+}
+
+func (r *contextHttpRecorder) reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.records = nil
+}
+
+func (r *contextHttpRecorder) start(req *http.Request) *HttpRequestRecord {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	record := &HttpRequestRecord{
+		Method: req.Method,
+		Url:    req.URL.String(),
+		Host:   req.URL.Host,
+		Header: req.Header.Clone(),
+	}
+	r.records = append(r.records, record)
+	return record
+}
+
+func (r *contextHttpRecorder) finish(record *HttpRequestRecord, duration time.Duration, resp *http.Response, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	record.Duration = duration
+	record.Err = err
+	if resp != nil {
+		record.StatusCode = resp.StatusCode
+	}
+}
+
+type recordingTransport struct {
+	delegate http.RoundTripper
+	recorder *contextHttpRecorder
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	record := t.recorder.start(req)
+	start := time.Now()
+	resp, err := t.delegate.RoundTrip(req)
+	t.recorder.finish(record, time.Since(start), resp, err)
+	return resp, err
+}
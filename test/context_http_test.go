@@ -0,0 +1,128 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func givenHttpServer(t testing.TB) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Add("X-Multi", "a")
+		w.Header().Add("X-Multi", "b")
+		w.Header().Set("X-Echo", r.Header.Get("X-Request"))
+		w.Header().Set("Content-Length", "5")
+		_, _ = w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/file", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHttp_get(t *testing.T) {
+	srv := givenHttpServer(t)
+	tc := GivenContextWith(t, "../lib/types.lua")
+
+	t.Run("body", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local resp = require("http").get({url = "`+srv.URL+`/file"})
+return {resp.status_code, resp.body, resp.content_length}`, []any{float64(200), "hello", float64(5)})
+	})
+	t.Run("headers", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local resp = require("http").get({url = "`+srv.URL+`/file", headers = {["X-Request"] = "foo"}})
+return {resp.headers["Etag"], resp.headers["X-Multi"], resp.headers["X-Echo"], resp.headers_all["X-Multi"], resp.headers_all["Etag"]}`, []any{`"abc"`, "a", "foo", []any{"a", "b"}, []any{`"abc"`}})
+	})
+	t.Run("followsRedirects", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local resp = require("http").get({url = "`+srv.URL+`/redirect"})
+return {resp.status_code, resp.body, resp.final_url}`, []any{float64(200), "hello", srv.URL + "/file"})
+	})
+	t.Run("doesNotFollowRedirects", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local resp = require("http").get({url = "`+srv.URL+`/redirect", follow_redirects = false})
+return {resp.status_code, resp.headers["Location"], resp.final_url}`, []any{float64(302), "/file", srv.URL + "/redirect"})
+	})
+	t.Run("maxRedirects", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local _, err = require("http").get({url = "`+srv.URL+`/loop", max_redirects = 3})
+return err:find("stopped after 3 redirects", 1, true) ~= nil`, true)
+	})
+	t.Run("timeout", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local _, err = require("http").get({url = "`+srv.URL+`/slow", timeout = 0.1})
+return err:find("Client.Timeout exceeded", 1, true) ~= nil`, true)
+	})
+	t.Run("recordsRequests", func(t *testing.T) {
+		tc.HTTP().ResetRequests()
+		tc.ShouldEvaluate(t, `return require("http").get({url = "`+srv.URL+`/redirect", headers = {["X-Request"] = {"a", "b"}}})`)
+
+		tc.HTTP().ShouldNotHaveRequested(t, srv.URL+"/missing")
+		redirect := tc.HTTP().ShouldHaveRequested(t, srv.URL+"/redirect", 1)
+		file := tc.HTTP().ShouldHaveRequested(t, srv.URL+"/file", 1)
+		tc.HTTP().ShouldOnlyHaveRequestedHosts(t, srv.Listener.Addr().String())
+
+		require.Equal(t, []string{"a", "b"}, redirect[0].Header.Values("X-Request"))
+		require.Equal(t, http.StatusFound, redirect[0].StatusCode)
+		require.Equal(t, http.MethodGet, file[0].Method)
+		require.Equal(t, http.StatusOK, file[0].StatusCode)
+		require.NoError(t, file[0].Err)
+	})
+	t.Run("withoutUrl", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local _, err = require("http").get({})
+return err`, "url is required")
+	})
+}
+
+func TestHttp_head(t *testing.T) {
+	srv := givenHttpServer(t)
+	tc := GivenContextWith(t, "../lib/types.lua")
+
+	tc.ShouldEvaluateTo(t, `local resp = require("http").head({url = "`+srv.URL+`/file"})
+return {resp.status_code, resp.body == nil, resp.content_length, resp.headers["Etag"]}`, []any{float64(200), true, float64(5), `"abc"`})
+}
+
+func TestHttp_download_file(t *testing.T) {
+	srv := givenHttpServer(t)
+	tc := GivenContextWith(t, "../lib/types.lua")
+
+	t.Run("success", func(t *testing.T) {
+		fn := filepath.Join(t.TempDir(), "file")
+		tc.ShouldEvaluateTo(t, `return require("http").download_file({url = "`+srv.URL+`/redirect"}, [[`+fn+`]])`, nil)
+
+		content, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		require.Equal(t, "hello", string(content))
+	})
+	t.Run("notFound", func(t *testing.T) {
+		fn := filepath.Join(t.TempDir(), "file")
+		tc.ShouldEvaluateTo(t, `return require("http").download_file({url = "`+srv.URL+`/missing"}, [[`+fn+`]])`, "download of "+srv.URL+"/missing failed with status 404")
+		require.NoFileExists(t, fn)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		dir := t.TempDir()
+		fn := filepath.Join(dir, "file")
+		tc.HTTP().GivenFault(srv.URL+"/file", HttpFault{TruncateBodyAfter: 2, Times: 1})
+
+		err := tc.ShouldEvaluate(t, `return require("http").download_file({url = "`+srv.URL+`/file"}, [[`+fn+`]])`)
+		require.Contains(t, err, "download of "+srv.URL+"/file failed: ")
+		require.NoFileExists(t, fn)
+		entries, rErr := os.ReadDir(dir)
+		require.NoError(t, rErr)
+		require.Empty(t, entries, "No partial download should be left behind.")
+	})
+}
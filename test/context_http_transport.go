@@ -0,0 +1,247 @@
+package test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// contextHttpTransport creates the transport which finally executes the
+// requests of the http module, configured (like the real runtime) by the
+// environment of the Context:
+//
+//   - HTTP_PROXY, HTTPS_PROXY and NO_PROXY (or their lowercase variants)
+//     select the proxy of each request. Like net/http does, requests to
+//     loopback hosts are never proxied.
+//   - SSL_CERT_FILE adds the certificates of the given PEM file to the trusted
+//     ones of the system.
+//   - MONGOD_HTTP_AUTH sends an Authorization header to the given hosts, like
+//     artifactory.example.com=Bearer abc,localhost:8080=Basic Zm9vOmJhcg==.
+//     Plain http hosts only get it with an explicit scheme (like
+//     http://localhost:8080=...). Requests which already have an
+//     Authorization header stay untouched.
+//
+// The transport is rebuilt only if the configuration changes.
+type contextHttpTransport struct {
+	getenv func(string) (string, bool)
+
+	mutex     sync.Mutex
+	key       string
+	transport http.RoundTripper
+}
+
+var contextHttpTransportEnvKeys = []string{
+	"HTTP_PROXY", "http_proxy",
+	"HTTPS_PROXY", "https_proxy",
+	"NO_PROXY", "no_proxy",
+	"SSL_CERT_FILE",
+	"MONGOD_HTTP_AUTH",
+}
+
+func (t *contextHttpTransport) lookup(keys ...string) string {
+	getenv := t.getenv
+	if getenv == nil {
+		getenv = os.LookupEnv
+	}
+	for _, key := range keys {
+		if v, ok := getenv(key); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (t *contextHttpTransport) get() (http.RoundTripper, error) {
+	var key strings.Builder
+	for _, k := range contextHttpTransportEnvKeys {
+		key.WriteString(k + "=" + t.lookup(k) + "\n")
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.transport != nil && t.key == key.String() {
+		return t.transport, nil
+	}
+
+	transport, err := t.build()
+	if err != nil {
+		return nil, err
+	}
+	if old, ok := t.transport.(*authTransport); ok {
+		old.delegate.(*http.Transport).CloseIdleConnections()
+	}
+	t.key, t.transport = key.String(), transport
+	return transport, nil
+}
+
+func (t *contextHttpTransport) build() (http.RoundTripper, error) {
+	result := http.DefaultTransport.(*http.Transport).Clone()
+
+	proxies := t.proxies()
+	result.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxies.of(req.URL)
+	}
+
+	if fn := t.lookup("SSL_CERT_FILE"); fn != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read SSL_CERT_FILE %s: %w", fn, err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("SSL_CERT_FILE %s does not contain any PEM encoded certificate", fn)
+		}
+		result.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	auth, err := parseContextHttpAuth(t.lookup("MONGOD_HTTP_AUTH"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &authTransport{delegate: result, auth: auth}, nil
+}
+
+func (t *contextHttpTransport) proxies() contextHttpProxies {
+	return contextHttpProxies{
+		http:    t.lookup("HTTP_PROXY", "http_proxy"),
+		https:   t.lookup("HTTPS_PROXY", "https_proxy"),
+		noProxy: t.lookup("NO_PROXY", "no_proxy"),
+	}
+}
+
+// proxyOf returns the proxy which the given request is sent through, or nil
+// if it is sent directly.
+func (t *contextHttpTransport) proxyOf(req *http.Request) (*url.URL, error) {
+	return t.proxies().of(req.URL)
+}
+
+type contextHttpProxies struct {
+	http    string
+	https   string
+	noProxy string
+}
+
+func (p contextHttpProxies) of(u *url.URL) (*url.URL, error) {
+	var plain string
+	switch u.Scheme {
+	case "http":
+		plain = p.http
+	case "https":
+		plain = p.https
+	}
+	if plain == "" || p.bypasses(u) {
+		return nil, nil
+	}
+
+	if !strings.Contains(plain, "://") {
+		plain = "http://" + plain
+	}
+	result, err := url.Parse(plain)
+	if err != nil {
+		return nil, fmt.Errorf("illegal proxy %s: %w", plain, err)
+	}
+	return result, nil
+}
+
+func (p contextHttpProxies) bypasses(u *url.URL) bool {
+	hostname := strings.ToLower(u.Hostname())
+	if isLoopbackHost(hostname) {
+		return true
+	}
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+
+	for _, entry := range strings.Split(p.noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return true
+		case strings.Contains(entry, "/"):
+			if _, network, err := net.ParseCIDR(entry); err == nil {
+				if ip := net.ParseIP(hostname); ip != nil && network.Contains(ip) {
+					return true
+				}
+			}
+			continue
+		}
+
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if p != port {
+				continue
+			}
+			entry = h
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if hostname == entry || strings.HasSuffix(hostname, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseContextHttpAuth parses the Authorization headers per host (with an
+// optional port) of MONGOD_HTTP_AUTH. The entries are keyed by
+// <scheme>://<host>; without an explicit scheme, an entry only applies to
+// https, so the header is never sent in plain text by accident.
+func parseContextHttpAuth(plain string) (map[string]string, error) {
+	result := map[string]string{}
+	for i, entry := range strings.Split(plain, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		host, value, ok := strings.Cut(entry, "=")
+		host, value = strings.ToLower(strings.TrimSpace(host)), strings.TrimSpace(value)
+		scheme, rest, explicit := strings.Cut(host, "://")
+		if !explicit {
+			scheme, rest = "https", host
+		}
+		// Never echo the entry itself, it might contain the credentials.
+		if !ok || rest == "" || value == "" {
+			return nil, fmt.Errorf("illegal entry #%d of MONGOD_HTTP_AUTH: expected [<scheme>://]<host>=<authorization>", i+1)
+		}
+		if scheme != "https" && scheme != "http" {
+			return nil, fmt.Errorf("illegal entry #%d of MONGOD_HTTP_AUTH: the scheme must be http or https, but is %s", i+1, scheme)
+		}
+		result[scheme+"://"+rest] = value
+	}
+	return result, nil
+}
+
+type authTransport struct {
+	delegate http.RoundTripper
+	auth     map[string]string
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.auth) == 0 || req.Header.Get("Authorization") != "" {
+		return t.delegate.RoundTrip(req)
+	}
+
+	// Match the host with its port first, so every port can have its own.
+	scheme := strings.ToLower(req.URL.Scheme) + "://"
+	value, ok := t.auth[scheme+strings.ToLower(req.URL.Host)]
+	if !ok {
+		value, ok = t.auth[scheme+strings.ToLower(req.URL.Hostname())]
+	}
+	if !ok {
+		return t.delegate.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", value)
+	return t.delegate.RoundTrip(req)
+}
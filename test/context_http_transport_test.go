@@ -0,0 +1,310 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// givenCa generates a CA, writes it PEM encoded into a file (see
+// SSL_CERT_FILE) and returns the file together with a certificate for the
+// given hosts which is signed by this CA.
+func givenCa(t testing.TB, hosts ...string) (string, tls.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "vfox-mongod test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDer)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	fn := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(fn, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer}), 0644))
+	return fn, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// givenTlsServer starts a TLS server with the given certificate, which
+// responds with "secure" and the received Authorization header (as
+// X-Authorization).
+func givenTlsServer(t testing.TB, certificate tls.Certificate) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Authorization", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte("secure"))
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// givenProxy starts a proxy which answers plain http requests itself (with
+// "proxied " and the requested url) and tunnels every CONNECT to the given
+// origin, regardless of the requested host. It returns the requested urls
+// (or hosts for CONNECT).
+func givenProxy(t testing.TB, origin *httptest.Server) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mutex sync.Mutex
+	var requested []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		if r.Method == http.MethodConnect {
+			requested = append(requested, "CONNECT "+r.Host)
+		} else {
+			requested = append(requested, r.Method+" "+r.URL.String())
+		}
+		mutex.Unlock()
+
+		if r.Method != http.MethodConnect {
+			w.Header().Set("X-Authorization", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte("proxied " + r.URL.String()))
+			return
+		}
+
+		upstream, err := net.Dial("tcp", origin.Listener.Addr().String())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			_ = upstream.Close()
+			return
+		}
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			_, _ = io.Copy(upstream, conn)
+			_ = upstream.Close()
+		}()
+		go func() {
+			_, _ = io.Copy(conn, upstream)
+			_ = conn.Close()
+		}()
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), requested...)
+	}
+}
+
+func TestHttp_proxy(t *testing.T) {
+	caFile, certificate := givenCa(t, "mirror.example.com", "127.0.0.1")
+	origin := givenTlsServer(t, certificate)
+	proxy, requested := givenProxy(t, origin)
+	tc := GivenContextWith(t, "../lib/types.lua")
+	tc.Setenv("HTTP_PROXY", proxy.URL)
+	tc.Setenv("HTTPS_PROXY", proxy.Listener.Addr().String())
+	tc.Setenv("SSL_CERT_FILE", caFile)
+
+	t.Run("http", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local resp, err = require("http").get({url = "http://mirror.example.com/full.json"})
+return resp and resp.body or err`, "proxied http://mirror.example.com/full.json")
+	})
+	t.Run("https", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local resp, err = require("http").get({url = "https://mirror.example.com/full.json"})
+return resp and resp.body or err`, "secure")
+	})
+	t.Run("untrusted", func(t *testing.T) {
+		tc.Setenv("SSL_CERT_FILE", "")
+		defer tc.Setenv("SSL_CERT_FILE", caFile)
+
+		tc.ShouldEvaluateTo(t, `local _, err = require("http").get({url = "https://mirror.example.com/full.json"})
+return err:find("certificate signed by unknown authority", 1, true) ~= nil`, true)
+	})
+	t.Run("bypassingTheProxy", func(t *testing.T) {
+		tc.Setenv("NO_PROXY", "mirror.example.com")
+		defer tc.Setenv("NO_PROXY", "")
+
+		tc.ShouldEvaluateTo(t, `local _, err = require("http").get({url = "https://mirror.example.com/full.json"})
+return err:find("network lockdown: request to https://mirror.example.com/full.json (called at", 1, true) ~= nil`, true)
+		require.Len(t, tc.HTTP().TakeLockdownViolations(), 1)
+	})
+	t.Run("loopbackIsNotProxied", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local resp, err = require("http").get({url = "`+origin.URL+`/full.json"})
+return resp and resp.body or err`, "secure")
+	})
+
+	assert.Equal(t, []string{
+		"GET http://mirror.example.com/full.json",
+		"CONNECT mirror.example.com:443",
+		"CONNECT mirror.example.com:443",
+	}, requested())
+}
+
+func TestHttp_proxy_bypasses(t *testing.T) {
+	proxies := contextHttpProxies{
+		http:    "proxy.example.com:3128",
+		https:   "https://secure-proxy.example.com",
+		noProxy: "internal.example.com, .corp.example.com,mirror.example.org:8080,10.0.0.0/8",
+	}
+
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"http://downloads.mongodb.org/full.json", "http://proxy.example.com:3128"},
+		{"https://downloads.mongodb.org/full.json", "https://secure-proxy.example.com"},
+		{"ftp://downloads.mongodb.org/full.json", ""},
+		{"https://internal.example.com/full.json", ""},
+		{"https://a.internal.example.com/full.json", ""},
+		{"https://notinternal.example.com/full.json", "https://secure-proxy.example.com"},
+		{"https://a.corp.example.com/full.json", ""},
+		{"https://corp.example.com/full.json", ""},
+		{"http://mirror.example.org:8080/full.json", ""},
+		{"http://mirror.example.org/full.json", "http://proxy.example.com:3128"},
+		{"http://10.1.2.3/full.json", ""},
+		{"http://11.1.2.3/full.json", "http://proxy.example.com:3128"},
+		{"http://localhost:8080/full.json", ""},
+		{"http://127.0.0.1:8080/full.json", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.url, func(t *testing.T) {
+			u, err := url.Parse(c.url)
+			require.NoError(t, err)
+
+			actual, err := proxies.of(u)
+			require.NoError(t, err)
+			if c.expected == "" {
+				assert.Nil(t, actual)
+			} else {
+				require.NotNil(t, actual)
+				assert.Equal(t, c.expected, actual.String())
+			}
+		})
+	}
+
+	t.Run("all", func(t *testing.T) {
+		actual, err := contextHttpProxies{http: "proxy.example.com:3128", noProxy: "*"}.of(&url.URL{Scheme: "http", Host: "downloads.mongodb.org"})
+		require.NoError(t, err)
+		assert.Nil(t, actual)
+	})
+}
+
+func TestHttp_auth(t *testing.T) {
+	caFile, certificate := givenCa(t, "127.0.0.1")
+	origin := givenTlsServer(t, certificate)
+	other := givenTlsServer(t, certificate)
+	tc := GivenContextWith(t, "../lib/types.lua")
+	tc.Setenv("SSL_CERT_FILE", caFile)
+	tc.Setenv("MONGOD_HTTP_AUTH", "mirror.example.com=Basic Zm9vOmJhcg==, "+origin.Listener.Addr().String()+"=Bearer secret")
+	authorizationOf := func(t *testing.T, u string, headers string) any {
+		return tc.ShouldEvaluate(t, `local resp, err = require("http").get({url = "`+u+`", headers = `+headers+`})
+return resp and resp.headers["X-Authorization"] or err`)
+	}
+
+	assert.Equal(t, "Bearer secret", authorizationOf(t, origin.URL+"/full.json", "{}"))
+	assert.Equal(t, "Bearer explicit", authorizationOf(t, origin.URL+"/full.json", `{Authorization = "Bearer explicit"}`), "Explicit header should be kept.")
+	assert.Equal(t, "", authorizationOf(t, other.URL+"/full.json", "{}"), "Other hosts should not get it.")
+	assert.Empty(t, tc.HTTP().ShouldHaveRequested(t, other.URL+"/full.json", 1)[0].Header.Get("Authorization"))
+
+	t.Run("plainHttp", func(t *testing.T) {
+		plain := httptest.NewServer(origin.Config.Handler)
+		t.Cleanup(plain.Close)
+		tc.Setenv("MONGOD_HTTP_AUTH", plain.Listener.Addr().String()+"=Bearer secret")
+
+		assert.Equal(t, "", authorizationOf(t, plain.URL+"/full.json", "{}"), "Plain http should not get it without an explicit scheme.")
+
+		tc.Setenv("MONGOD_HTTP_AUTH", "http://"+plain.Listener.Addr().String()+"=Bearer plain")
+		assert.Equal(t, "Bearer plain", authorizationOf(t, plain.URL+"/full.json", "{}"))
+		assert.Equal(t, "", authorizationOf(t, origin.URL+"/full.json", "{}"), "An explicit http should not apply to https.")
+	})
+}
+
+func TestHttp_transport_illegal(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/types.lua")
+	get := `local _, err = require("http").get({url = "http://127.0.0.1:1/full.json"})
+return err`
+
+	t.Run("missingCertFile", func(t *testing.T) {
+		fn := filepath.Join(t.TempDir(), "missing.pem")
+		tc.Setenv("SSL_CERT_FILE", fn)
+		defer tc.Setenv("SSL_CERT_FILE", "")
+
+		err := tc.ShouldEvaluate(t, get)
+		assert.Contains(t, err, "cannot read SSL_CERT_FILE "+fn+": ")
+	})
+	t.Run("noCertificate", func(t *testing.T) {
+		fn := filepath.Join(t.TempDir(), "empty.pem")
+		require.NoError(t, os.WriteFile(fn, []byte("nothing"), 0644))
+		tc.Setenv("SSL_CERT_FILE", fn)
+		defer tc.Setenv("SSL_CERT_FILE", "")
+
+		tc.ShouldEvaluateTo(t, get, "SSL_CERT_FILE "+fn+" does not contain any PEM encoded certificate")
+	})
+	t.Run("illegalAuth", func(t *testing.T) {
+		tc.Setenv("MONGOD_HTTP_AUTH", "mirror.example.com=Basic Zm9vOmJhcg==,Bearer secret")
+		defer tc.Setenv("MONGOD_HTTP_AUTH", "")
+
+		err := tc.ShouldEvaluate(t, get)
+		assert.Equal(t, `illegal entry #2 of MONGOD_HTTP_AUTH: expected [<scheme>://]<host>=<authorization>`, err)
+		assert.NotContains(t, err, "secret")
+	})
+	t.Run("illegalAuthScheme", func(t *testing.T) {
+		tc.Setenv("MONGOD_HTTP_AUTH", "ftp://mirror.example.com=Bearer secret")
+		defer tc.Setenv("MONGOD_HTTP_AUTH", "")
+
+		tc.ShouldEvaluateTo(t, get, `illegal entry #1 of MONGOD_HTTP_AUTH: the scheme must be http or https, but is ftp`)
+	})
+}
+
+func TestHttp_proxy_lockdown(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/types.lua")
+	tc.Setenv("HTTPS_PROXY", "proxy.example.com:3128")
+
+	// The connection goes to the proxy, so the lockdown checks its host.
+	tc.ShouldEvaluateTo(t, `local _, err = require("http").get({url = "https://mirror.example.com/full.json"})
+return err:find("network lockdown: request to https://mirror.example.com/full.json via proxy proxy.example.com:3128 (called at", 1, true) ~= nil`, true)
+	require.Len(t, tc.HTTP().TakeLockdownViolations(), 1)
+}
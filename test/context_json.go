@@ -3,6 +3,9 @@ package test
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	lua "github.com/yuin/gopher-lua"
 )
@@ -19,8 +22,11 @@ func contextJsonLoader(L *lua.LState) int {
 
 func apiDecode(L *lua.LState) int {
 	str := L.CheckString(1)
+	reviver := L.OptFunction(2, nil)
 
-	value, err := Decode(L, []byte(str))
+	value, err := Decode(L, []byte(str), DecodeOptions{
+		Reviver: reviver,
+	})
 	if err != nil {
 		L.Push(lua.LNil)
 		L.Push(lua.LString(err.Error()))
@@ -32,8 +38,12 @@ func apiDecode(L *lua.LState) int {
 
 func apiEncode(L *lua.LState) int {
 	value := L.CheckAny(1)
+	var opts EncodeOptions
+	if lOpts := L.OptTable(2, nil); lOpts != nil {
+		opts.UseToString = lua.LVAsBool(lOpts.RawGetString("tostring"))
+	}
 
-	data, err := Encode(value)
+	data, err := Encode(L, value, opts)
 	if err != nil {
 		L.Push(lua.LNil)
 		L.Push(lua.LString(err.Error()))
@@ -55,19 +65,196 @@ func (i invalidTypeError) Error() string {
 	return `cannot encode ` + lua.LValueType(i).String() + ` to JSON`
 }
 
-func Encode(value lua.LValue) ([]byte, error) {
-	return json.Marshal(jsonValue{
+// EncodeError reports where inside the encoded value the encoding failed.
+// Path is a JSON pointer (RFC 6901) to the offending value.
+type EncodeError struct {
+	Path string
+	Err  error
+}
+
+func (e *EncodeError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return e.Err.Error() + " at " + path
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError reports where inside the decoded document the decoding failed.
+// Offset is the byte offset; Line and Column are 1-based.
+type DecodeError struct {
+	Offset int64
+	Line   int
+	Column int
+	Err    error
+}
+
+func newDecodeError(data []byte, offset int64, err error) *DecodeError {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	result := &DecodeError{
+		Offset: offset,
+		Line:   1,
+		Column: 1,
+		Err:    err,
+	}
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			result.Line++
+			result.Column = 1
+		} else {
+			result.Column++
+		}
+	}
+	return result
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%v at line %d, column %d (offset %d)", e.Err, e.Line, e.Column, e.Offset)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ReviveError reports which value a reviver failed for. Path is a JSON
+// pointer (RFC 6901) to this value.
+type ReviveError struct {
+	Path string
+	Err  error
+}
+
+func (e *ReviveError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return "reviver failed at " + path + ": " + e.Err.Error()
+}
+
+func (e *ReviveError) Unwrap() error {
+	return e.Err
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func jsonPointerOf(parent string, key lua.LValue) string {
+	if n, ok := key.(lua.LNumber); ok {
+		// JSON arrays are 0-based, Lua arrays 1-based.
+		return parent + "/" + strconv.Itoa(int(n)-1)
+	}
+	return parent + "/" + jsonPointerEscaper.Replace(key.String())
+}
+
+// EncodeOptions controls how Encode treats values which cannot be
+// represented in JSON directly.
+type EncodeOptions struct {
+	// UseToString makes Encode fall back to the __tostring metamethod of
+	// tables and userdata which do not provide a __tojson metamethod.
+	UseToString bool
+}
+
+// Encode converts the given value into JSON. Tables and userdata with a
+// __tojson metamethod are replaced by the result of this metamethod before
+// they are encoded.
+func Encode(L *lua.LState, value lua.LValue, opts EncodeOptions) ([]byte, error) {
+	data, err := json.Marshal(jsonValue{
 		LValue:  value,
+		L:       L,
+		opts:    opts,
 		visited: make(map[*lua.LTable]bool),
 	})
+	var ee *EncodeError
+	if errors.As(err, &ee) {
+		return nil, ee
+	}
+	return data, err
 }
 
 type jsonValue struct {
 	lua.LValue
+	L       *lua.LState
+	opts    EncodeOptions
+	path    string
 	visited map[*lua.LTable]bool
 }
 
+func (j jsonValue) with(v lua.LValue) jsonValue {
+	j.LValue = v
+	return j
+}
+
+func (j jsonValue) child(key, v lua.LValue) jsonValue {
+	j.LValue = v
+	j.path = jsonPointerOf(j.path, key)
+	return j
+}
+
+func (j jsonValue) fail(err error) error {
+	var ee *EncodeError
+	if errors.As(err, &ee) {
+		return ee
+	}
+	return &EncodeError{Path: j.path, Err: err}
+}
+
+// replacement returns the value which should be encoded instead of j, if j
+// provides a __tojson (or, if enabled, a __tostring) metamethod.
+func (j jsonValue) replacement() (lua.LValue, bool, error) {
+	if j.L == nil {
+		return nil, false, nil
+	}
+
+	if fn, ok := j.L.GetMetaField(j.LValue, "__tojson").(*lua.LFunction); ok {
+		if err := j.L.CallByParam(lua.P{
+			Fn:      fn,
+			NRet:    1,
+			Protect: true,
+		}, j.LValue); err != nil {
+			return nil, false, err
+		}
+		result := j.L.Get(-1)
+		j.L.Pop(1)
+		return result, true, nil
+	}
+
+	if j.opts.UseToString && j.L.GetMetaField(j.LValue, "__tostring") != lua.LNil {
+		return j.L.ToStringMeta(j.LValue), true, nil
+	}
+
+	return nil, false, nil
+}
+
 func (j jsonValue) MarshalJSON() (data []byte, err error) {
+	defer func() {
+		if err != nil {
+			err = j.fail(err)
+		}
+	}()
+
+	switch j.LValue.(type) {
+	case *lua.LTable, *lua.LUserData:
+		replacement, ok, rErr := j.replacement()
+		if rErr != nil {
+			return nil, rErr
+		}
+		if ok {
+			if t, isTable := j.LValue.(*lua.LTable); isTable {
+				if replacement == t {
+					return nil, errNested
+				}
+				j.visited[t] = true
+				defer delete(j.visited, t)
+			}
+			return json.Marshal(j.with(replacement))
+		}
+	}
+
 	switch converted := j.LValue.(type) {
 	case lua.LBool:
 		data, err = json.Marshal(bool(converted))
@@ -82,6 +269,7 @@ func (j jsonValue) MarshalJSON() (data []byte, err error) {
 			return nil, errNested
 		}
 		j.visited[converted] = true
+		defer delete(j.visited, converted)
 
 		key, value := converted.Next(lua.LNil)
 
@@ -93,14 +281,14 @@ func (j jsonValue) MarshalJSON() (data []byte, err error) {
 			expectedKey := lua.LNumber(1)
 			for key != lua.LNil {
 				if key.Type() != lua.LTNumber {
-					err = errInvalidKeys
+					err = j.child(key, value).fail(errInvalidKeys)
 					return
 				}
 				if expectedKey != key {
-					err = errSparseArray
+					err = j.child(key, value).fail(errSparseArray)
 					return
 				}
-				arr = append(arr, jsonValue{value, j.visited})
+				arr = append(arr, j.child(key, value))
 				expectedKey++
 				key, value = converted.Next(key)
 			}
@@ -109,10 +297,10 @@ func (j jsonValue) MarshalJSON() (data []byte, err error) {
 			obj := make(map[string]jsonValue)
 			for key != lua.LNil {
 				if key.Type() != lua.LTString {
-					err = errInvalidKeys
+					err = j.child(key, value).fail(errInvalidKeys)
 					return
 				}
-				obj[key.String()] = jsonValue{value, j.visited}
+				obj[key.String()] = j.child(key, value)
 				key, value = converted.Next(key)
 			}
 			data, err = json.Marshal(obj)
@@ -125,13 +313,78 @@ func (j jsonValue) MarshalJSON() (data []byte, err error) {
 	return
 }
 
-func Decode(L *lua.LState, data []byte) (lua.LValue, error) {
+// DecodeOptions controls how Decode converts JSON into Lua values.
+type DecodeOptions struct {
+	// Reviver is called as reviver(key, value) for every decoded value,
+	// innermost values first and the root last with an empty string as
+	// key. Its result replaces the decoded value; nil removes it (the
+	// following elements of an array move up).
+	Reviver *lua.LFunction
+}
+
+func Decode(L *lua.LState, data []byte, opts DecodeOptions) (lua.LValue, error) {
 	var value interface{}
 	err := json.Unmarshal(data, &value)
-	if err != nil {
+	var se *json.SyntaxError
+	var ute *json.UnmarshalTypeError
+	if errors.As(err, &se) {
+		offset := se.Offset
+		if offset > 0 && strings.HasPrefix(se.Error(), "invalid character") {
+			// The offset points behind the offending character.
+			offset--
+		}
+		return nil, newDecodeError(data, offset, err)
+	} else if errors.As(err, &ute) {
+		return nil, newDecodeError(data, ute.Offset, err)
+	} else if err != nil {
 		return nil, err
 	}
-	return DecodeValue(L, value), nil
+	result := DecodeValue(L, value)
+	if opts.Reviver != nil {
+		return revive(L, opts.Reviver, "", lua.LString(""), result)
+	}
+	return result, nil
+}
+
+func revive(L *lua.LState, reviver *lua.LFunction, path string, key, value lua.LValue) (lua.LValue, error) {
+	if tbl, ok := value.(*lua.LTable); ok {
+		var err error
+		var keys []lua.LValue
+		tbl.ForEach(func(k, _ lua.LValue) {
+			keys = append(keys, k)
+		})
+		// Only arrays have numeric keys. They are compacted, so an element
+		// removed by the reviver does not leave a hole behind.
+		var elements []lua.LValue
+		for _, k := range keys {
+			var revived lua.LValue
+			if revived, err = revive(L, reviver, jsonPointerOf(path, k), k, tbl.RawGet(k)); err != nil {
+				return nil, err
+			}
+			if _, isIndex := k.(lua.LNumber); !isIndex {
+				tbl.RawSet(k, revived)
+			} else if revived != lua.LNil {
+				elements = append(elements, revived)
+			}
+		}
+		for i := tbl.Len(); i > 0; i-- {
+			tbl.RawSetInt(i, lua.LNil)
+		}
+		for _, element := range elements {
+			tbl.Append(element)
+		}
+	}
+
+	if err := L.CallByParam(lua.P{
+		Fn:      reviver,
+		NRet:    1,
+		Protect: true,
+	}, key, value); err != nil {
+		return nil, &ReviveError{Path: path, Err: err}
+	}
+	result := L.Get(-1)
+	L.Pop(1)
+	return result, nil
 }
 
 func DecodeValue(L *lua.LState, value interface{}) lua.LValue {
@@ -0,0 +1,154 @@
+package test
+
+import (
+	"testing"
+)
+
+func TestJson_encode(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/types.lua", "../lib/Semver.lua", "../lib/Version.lua", "../lib/Target.lua")
+
+	cases := []struct {
+		name     string
+		input    string
+		expected any
+	}{
+		{"semver", `Semver:new("1.2.3")`, `"1.2.3"`},
+		{"version", `Version:new("24.4")`, `"24.4"`},
+		{"nestedSemver", `{latest = Semver:new("8.0.0")}`, `{"latest":"8.0.0"}`},
+		{"arrayOfVersions", `{Version:new("1"), Version:new("1.2")}`, `["1","1.2"]`},
+		{"tojsonReturningTable", `setmetatable({}, {__tojson = function() return {a = 1} end})`, `{"a":1}`},
+		{"tostringWithoutOption", `Target:new("debian12")`, `{"distribution":"debian","os":"linux","version":"12"}`},
+		{"tostringWithOption", `Target:new("debian12"), {tostring = true}`, `"debian12"`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc.ShouldEvaluateTo(t, `return require("json").encode(`+c.input+`)`, c.expected)
+		})
+	}
+
+	t.Run("tojsonReturningItself", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local obj = setmetatable({}, {__tojson = function(self) return self end})
+local _, err = require("json").encode(obj)
+return err:find("cannot encode recursively nested tables to JSON", 1, true) ~= nil`, true)
+	})
+	t.Run("tojsonFailing", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local obj = setmetatable({}, {__tojson = function(self) error("expected") end})
+local result, err = require("json").encode(obj)
+return {result = result, failed = err ~= nil}`, map[string]any{"failed": true})
+	})
+}
+
+func TestJson_decode(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/types.lua", "../lib/Semver.lua")
+
+	t.Run("withoutReviver", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `return require("json").decode([[{"latest":"8.0.0"}]])`, map[string]any{"latest": "8.0.0"})
+	})
+	t.Run("reviverCreatesObjects", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local decoded = require("json").decode([[{"latest":"8.0.0","versions":["7.0.1"]}]], function(key, value)
+	if key == "latest" then
+		return Semver:new(value)
+	end
+	return value
+end)
+return t.instanceof(decoded.latest, Semver) and decoded.latest.major == 8 and decoded.versions[1] == "7.0.1"`, true)
+	})
+	t.Run("reviverRemovesEntries", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `return require("json").decode([[{"a":1,"b":{"c":2,"d":3}}]], function(key, value)
+	if key == "c" then
+		return nil
+	end
+	return value
+end)`, map[string]any{"a": float64(1), "b": map[string]any{"d": float64(3)}})
+	})
+	t.Run("reviverRemovesArrayElements", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local decoded = require("json").decode([[{"versions":["7.0.1","skip","8.0.0","skip"]}]], function(key, value)
+	if value == "skip" then
+		return nil
+	end
+	return value
+end)
+return {n = #decoded.versions, first = decoded.versions[1], second = decoded.versions[2], third = decoded.versions[3]}`, map[string]any{"n": float64(2), "first": "7.0.1", "second": "8.0.0"})
+	})
+	t.Run("reviverIsCalledInnermostFirst", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local calls = {}
+require("json").decode([[{"a":{"b":true}}]], function(key, value)
+	table.insert(calls, key)
+	return value
+end)
+return calls`, []any{"b", "a", ""})
+	})
+	t.Run("roundtrip", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local json = require("json")
+local decoded = json.decode(json.encode({latest = Semver:new("8.0.0")}), function(key, value)
+	if key == "latest" then
+		return Semver:new(value)
+	end
+	return value
+end)
+return Semver.cmp(decoded.latest, "8.0.0")`, float64(0))
+	})
+}
+
+func TestJson_encodeErrors(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/types.lua", "../lib/Semver.lua")
+
+	cases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"sparseArrayAtRoot", `{[1] = "a", [3] = "c"}`, `cannot encode sparse array at /2`},
+		{"sparseArrayNested", `{versions = {["8.0.0"] = {url = {[2] = "x"}}}}`, `cannot encode sparse array at /versions/8.0.0/url/1`},
+		{"mixedKeys", `{versions = {"a", foo = "b"}}`, `cannot encode mixed or invalid key types at /versions/foo`},
+		{"invalidType", `{versions = {{url = function() end}}}`, `cannot encode function to JSON at /versions/0/url`},
+		{"escapedKeys", `{["a/b"] = {["c~d"] = print}}`, `cannot encode function to JSON at /a~1b/c~0d`},
+		{"nested", `(function() local a = {}; a.b = {c = a}; return a end)()`, `cannot encode recursively nested tables to JSON at /b/c`},
+		{"tojsonResult", `{latest = setmetatable({}, {__tojson = function() return print end})}`, `cannot encode function to JSON at /latest`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc.ShouldEvaluateTo(t, `local _, err = require("json").encode(`+c.input+`)
+return err`, c.expected)
+		})
+	}
+
+	t.Run("sameTableTwice", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local v = Semver:new("1.2.3")
+local s = {a = 1}
+return require("json").encode({v, v, {s, s}})`, `["1.2.3","1.2.3",[{"a":1},{"a":1}]]`)
+	})
+}
+
+func TestJson_decodeErrors(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/types.lua")
+
+	cases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"invalidCharacter", "{\n  \"a\": 1,\n  \"b\": x\n}", `invalid character 'x' looking for beginning of value at line 3, column 8 (offset 19)`},
+		{"unexpectedEnd", "{\n  \"a\": [1,", `unexpected end of JSON input at line 2, column 11 (offset 12)`},
+		{"trailingComma", `{"a": 1,}`, `invalid character '}' looking for beginning of object key string at line 1, column 9 (offset 8)`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc.ShouldEvaluateTo(t, `local _, err = require("json").decode([[`+c.input+`]])
+return err`, c.expected)
+		})
+	}
+
+	t.Run("reviverFailing", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local _, err = require("json").decode([[{"versions":{"8.0.0":{"url":"x"}}}]], function(key, value)
+	if key == "url" then
+		error("unexpected url")
+	end
+	return value
+end)
+return err:find("reviver failed at /versions/8.0.0/url: ", 1, true) ~= nil`, true)
+	})
+}
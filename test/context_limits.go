@@ -0,0 +1,140 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ContextLimits restricts the execution of the Lua code of a Context, so an
+// accidental endless loop or recursion fails the test instead of hanging or
+// crashing the whole test binary.
+type ContextLimits struct {
+	// Timeout of every evaluation (see Evaluate); this includes requests of
+	// the http module. 0 means no timeout.
+	Timeout time.Duration
+
+	// CallStackSize is the maximum depth of the call stack. 0 means
+	// lua.CallStackSize.
+	CallStackSize int
+
+	// RegistryMaxSize is the maximum number of values on the stacks of all
+	// calls together (the registry). 0 means lua.RegistrySize.
+	RegistryMaxSize int
+}
+
+// DefaultContextLimits are used by GivenContext and NewContext.
+var DefaultContextLimits = ContextLimits{
+	Timeout: time.Minute,
+}
+
+func (l ContextLimits) options() lua.Options {
+	result := lua.Options{
+		CallStackSize: l.CallStackSize,
+		RegistrySize:  lua.RegistrySize,
+	}
+	if l.RegistryMaxSize > 0 {
+		if l.RegistryMaxSize < result.RegistrySize {
+			result.RegistrySize = l.RegistryMaxSize
+		} else {
+			result.RegistryMaxSize = l.RegistryMaxSize
+		}
+	}
+	return result
+}
+
+func (l ContextLimits) callStackSize() int {
+	if l.CallStackSize > 0 {
+		return l.CallStackSize
+	}
+	return lua.CallStackSize
+}
+
+func (l ContextLimits) registryMaxSize() int {
+	if l.RegistryMaxSize > 0 {
+		return l.RegistryMaxSize
+	}
+	return lua.RegistrySize
+}
+
+// LimitError reports that an evaluation exceeded one of its ContextLimits.
+type LimitError struct {
+	// Limit which was exceeded, like timeout, call stack size or registry
+	// size.
+	Limit string
+	// Value of the exceeded limit.
+	Value any
+	// Location of the Lua code where the limit was exceeded, like
+	// ../lib/Target.lua:42 (if known).
+	Location string
+	Err      error
+}
+
+func (e *LimitError) Error() string {
+	location := e.Location
+	if location == "" {
+		location = "<unknown>"
+	}
+	return fmt.Sprintf("evaluation exceeded the %s of %v at %s", e.Limit, e.Value, location)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+var luaErrorLocationRegexp = regexp.MustCompile(`^([^:\n]+:\d+): `)
+
+// pcall calls the function on top of the stack (like LState.PCall with one
+// result) within the limits of this Context and reports every exceeded one
+// as LimitError.
+func (c *Context) pcall() error {
+	L := c.getL()
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if timeout := c.Limits.Timeout; timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+
+	err := L.PCall(0, 1, nil)
+	if err == nil {
+		return nil
+	}
+
+	var message string
+	var lae *lua.ApiError
+	if errors.As(err, &lae) && lae.Object != nil {
+		message = lae.Object.String()
+	}
+	var location string
+	if m := luaErrorLocationRegexp.FindStringSubmatch(message); m != nil {
+		location = m[1]
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return &LimitError{Limit: "timeout", Value: c.Limits.Timeout, Location: location, Err: err}
+	case strings.HasSuffix(message, "stack overflow") || strings.Contains(message, "callstack overflow"):
+		return &LimitError{Limit: "call stack size", Value: c.Limits.callStackSize(), Location: location, Err: err}
+	case strings.HasSuffix(message, "registry overflow"):
+		return &LimitError{Limit: "registry size", Value: c.Limits.registryMaxSize(), Location: location, Err: err}
+	}
+	return err
+}
+
+// shouldNotExceedLimits fails the given test if the given error is a
+// LimitError.
+func shouldNotExceedLimits(t testing.TB, err error) {
+	t.Helper()
+	var le *LimitError
+	if errors.As(err, &le) {
+		t.Fatalf("%v", le)
+	}
+}
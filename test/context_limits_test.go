@@ -0,0 +1,150 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextLimits_timeout(t *testing.T) {
+	tc := GivenContextWithLimits(t, ContextLimits{Timeout: 100 * time.Millisecond})
+
+	start := time.Now()
+	_, err := tc.Evaluate(`local function spin()
+	while true do end
+end
+spin()`)
+
+	var le *LimitError
+	require.ErrorAs(t, err, &le)
+	assert.Equal(t, "timeout", le.Limit)
+	assert.Equal(t, `<string>:2`, le.Location)
+	assert.EqualError(t, err, "evaluation exceeded the timeout of 100ms at <string>:2")
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	t.Run("recovers", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `return 1 + 1`, float64(2))
+	})
+}
+
+func TestContextLimits_timeoutOfHttp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	tc := GivenContextWithLimits(t, ContextLimits{Timeout: 200 * time.Millisecond})
+
+	start := time.Now()
+	_, err := tc.Evaluate(`local resp, err = require("http").get({url = "` + srv.URL + `"})
+return err`)
+
+	var le *LimitError
+	require.ErrorAs(t, err, &le)
+	assert.Equal(t, "timeout", le.Limit)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestContextLimits_callStackSize(t *testing.T) {
+	tc := GivenContextWithLimits(t, ContextLimits{CallStackSize: 64})
+
+	_, err := tc.Evaluate(`local function recurse(n)
+	return 1 + recurse(n + 1)
+end
+return recurse(1)`)
+
+	assert.EqualError(t, err, "evaluation exceeded the call stack size of 64 at <string>:2")
+
+	t.Run("withinLimit", func(t *testing.T) {
+		tc.ShouldEvaluateTo(t, `local function recurse(n)
+	if n >= 32 then
+		return n
+	end
+	return recurse(n + 1)
+end
+return recurse(1)`, float64(32))
+	})
+}
+
+func TestContextLimits_registryMaxSize(t *testing.T) {
+	tc := GivenContextWithLimits(t, ContextLimits{RegistryMaxSize: 1024})
+
+	_, err := tc.Evaluate(`local values = {}
+for i = 1, 4096 do
+	values[i] = i
+end
+return #{unpack(values)}`)
+
+	var le *LimitError
+	require.ErrorAs(t, err, &le)
+	assert.Equal(t, "registry size", le.Limit)
+	assert.Equal(t, 1024, le.Value)
+	assert.Equal(t, "<string>:5", le.Location)
+
+	t.Run("growsUpToLimit", func(t *testing.T) {
+		tc := GivenContextWithLimits(t, ContextLimits{RegistryMaxSize: 64 * 1024})
+
+		tc.ShouldEvaluateTo(t, `local values = {}
+for i = 1, 16384 do
+	values[i] = i
+end
+return #{unpack(values)}`, float64(16384))
+	})
+}
+
+// recordingTB records the failures of a test instead of failing it.
+type recordingTB struct {
+	testing.TB
+	mutex    sync.Mutex
+	failures []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingTB) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	r.FailNow()
+}
+
+func (r *recordingTB) FailNow() {
+	runtime.Goexit()
+}
+
+func (r *recordingTB) run(f func(t testing.TB)) string {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(r)
+	}()
+	<-done
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return strings.Join(r.failures, "\n")
+}
+
+func TestContextLimits_reportedAsTestErrors(t *testing.T) {
+	tc := GivenContextWithLimits(t, ContextLimits{Timeout: 50 * time.Millisecond})
+
+	failures := (&recordingTB{TB: t}).run(func(t testing.TB) {
+		tc.ShouldEvaluate(t, `while true do end`)
+	})
+	assert.Contains(t, failures, "evaluation exceeded the timeout of 50ms at <string>:1")
+
+	failures = (&recordingTB{TB: t}).run(func(t testing.TB) {
+		tc.ShouldEvaluateToError(t, `while true do end`, "deadline")
+	})
+	assert.Equal(t, "evaluation exceeded the timeout of 50ms at <string>:1", failures, "An exceeded limit is never the expected error.")
+}
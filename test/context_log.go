@@ -0,0 +1,137 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/echocat/slf4g"
+	"github.com/echocat/slf4g/level"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// LogEntry is a message which the Lua code of a Context logged through the
+// log module.
+type LogEntry struct {
+	Level   level.Level
+	Message string
+	Fields  map[string]any
+}
+
+func (e LogEntry) String() string {
+	return fmt.Sprintf("[%v] %s %v", e.Level, e.Message, e.Fields)
+}
+
+type contextLogs struct {
+	mutex   sync.Mutex
+	entries []LogEntry
+}
+
+// Logs returns every entry which was logged through the log module so far.
+func (c *Context) Logs() []LogEntry {
+	c.logs.mutex.Lock()
+	defer c.logs.mutex.Unlock()
+	return append([]LogEntry(nil), c.logs.entries...)
+}
+
+// LogsMatching returns every entry of Logs with the given message.
+func (c *Context) LogsMatching(message string) []LogEntry {
+	var result []LogEntry
+	for _, e := range c.Logs() {
+		if e.Message == message {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// ResetLogs forgets every entry which was logged so far.
+func (c *Context) ResetLogs() {
+	c.logs.mutex.Lock()
+	defer c.logs.mutex.Unlock()
+	c.logs.entries = nil
+}
+
+// logLoader provides the log module: log.debug, log.info, log.warn and
+// log.error(message, fields) log the given message with the (optional) table
+// of fields to the Logger of this Context and capture it (see Logs).
+func (c *Context) logLoader(L *lua.LState) int {
+	t := L.NewTable()
+	L.SetFuncs(t, map[string]lua.LGFunction{
+		"debug": c.logFunction(level.Debug),
+		"info":  c.logFunction(level.Info),
+		"warn":  c.logFunction(level.Warn),
+		"error": c.logFunction(level.Error),
+	})
+	L.Push(t)
+	return 1
+}
+
+func (c *Context) logFunction(lvl level.Level) lua.LGFunction {
+	return func(L *lua.LState) int {
+		entry := LogEntry{
+			Level:   lvl,
+			Message: L.CheckString(1),
+			Fields:  map[string]any{},
+		}
+		if fields := L.OptTable(2, nil); fields != nil {
+			var err error
+			fields.ForEach(func(key, value lua.LValue) {
+				if err != nil {
+					return
+				}
+				var v any
+				if v, err = c.ValueToAny(value); err == nil {
+					entry.Fields[key.String()] = v
+				}
+			})
+			if err != nil {
+				L.RaiseError("cannot log fields of %q: %v", entry.Message, err)
+				return 0
+			}
+		}
+
+		c.log(entry)
+		return 0
+	}
+}
+
+// overridePrint routes print of the Lua code through the Logger of this
+// Context (with level info) instead of stdout; its entries are captured, too
+// (see Logs).
+func (c *Context) overridePrint() {
+	L := c.getL()
+	L.SetGlobal("print", L.NewFunction(func(L *lua.LState) int {
+		parts := make([]string, L.GetTop())
+		for i := range parts {
+			parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+		}
+		c.log(LogEntry{
+			Level:   level.Info,
+			Message: strings.Join(parts, "\t"),
+			Fields:  map[string]any{},
+		})
+		return 0
+	}))
+}
+
+func (c *Context) log(entry LogEntry) {
+	c.logs.mutex.Lock()
+	c.logs.entries = append(c.logs.entries, entry)
+	c.logs.mutex.Unlock()
+
+	var logger log.Logger = c.GetLogger()
+	if len(entry.Fields) > 0 {
+		logger = logger.WithAll(entry.Fields)
+	}
+	switch entry.Level {
+	case level.Debug:
+		logger.Debug(entry.Message)
+	case level.Info:
+		logger.Info(entry.Message)
+	case level.Warn:
+		logger.Warn(entry.Message)
+	default:
+		logger.Error(entry.Message)
+	}
+}
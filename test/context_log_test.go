@@ -0,0 +1,65 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/echocat/slf4g/level"
+	"github.com/echocat/slf4g/sdk/testlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/types.lua")
+	// Errors fail the test by default; these are expected.
+	tc.Logger = testlog.NewProvider(t, testlog.FailAtLevel(testlog.NeverFailLevel)).GetRootLogger()
+
+	tc.ShouldEvaluateTo(t, `local log = require("log")
+log.debug("Debugging.")
+log.info("Informing.", {version = "8.0.9", count = 2})
+log.warn("Warning.", {targets = {"ubuntu2404", "windows"}})
+log.error("Failing.", {})
+return nil`, nil)
+
+	assert.Equal(t, []LogEntry{
+		{Level: level.Debug, Message: "Debugging.", Fields: map[string]any{}},
+		{Level: level.Info, Message: "Informing.", Fields: map[string]any{"version": "8.0.9", "count": float64(2)}},
+		{Level: level.Warn, Message: "Warning.", Fields: map[string]any{"targets": []any{"ubuntu2404", "windows"}}},
+		{Level: level.Error, Message: "Failing.", Fields: map[string]any{}},
+	}, tc.Logs())
+	assert.Len(t, tc.LogsMatching("Informing."), 1)
+
+	t.Run("illegal", func(t *testing.T) {
+		tc.ShouldEvaluateToError(t, `require("log").info({})`, "bad argument #1 to info (string expected, got table)")
+	})
+	t.Run("reset", func(t *testing.T) {
+		tc.ResetLogs()
+		assert.Empty(t, tc.Logs())
+	})
+}
+
+func TestLog_print(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/Semver.lua")
+
+	tc.ShouldEvaluateTo(t, `print("Hello", 42, nil, true)
+print(t:new("8.0.9"))
+print()
+return nil`, nil)
+
+	assert.Equal(t, []LogEntry{
+		{Level: level.Info, Message: "Hello\t42\tnil\ttrue", Fields: map[string]any{}},
+		{Level: level.Info, Message: "8.0.9", Fields: map[string]any{}},
+		{Level: level.Info, Message: "", Fields: map[string]any{}},
+	}, tc.Logs())
+}
+
+func TestLog_hostWarn(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/host.lua")
+
+	tc.ShouldEvaluateTo(t, `t.warn("Something is odd.")
+t.debug("Not reported without MONGOD_DEBUG.")
+return nil`, nil)
+
+	assert.Equal(t, []LogEntry{
+		{Level: level.Warn, Message: "Something is odd.", Fields: map[string]any{}},
+	}, tc.Logs())
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"os"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Setenv sets the given environment variable for the Lua code of this
+// Context only; the environment of the process stays untouched.
+func (c *Context) Setenv(key, value string) *Context {
+	if c.Env == nil {
+		c.Env = make(map[string]string)
+	}
+	c.Env[key] = value
+	return c
+}
+
+// Getenv returns the environment variable as the Lua code of this Context
+// sees it.
+func (c *Context) Getenv(key string) (string, bool) {
+	if v, ok := c.Env[key]; ok {
+		return v, true
+	}
+	if c.IsolatedEnv {
+		return "", false
+	}
+	return os.LookupEnv(key)
+}
+
+// Now returns the current time as the Lua code of this Context sees it.
+func (c *Context) Now() time.Time {
+	if v := c.Clock; v != nil {
+		return v()
+	}
+	return time.Now()
+}
+
+// GivenTime fixes the current time of this Context to the given one.
+func (c *Context) GivenTime(t time.Time) *Context {
+	c.Clock = func() time.Time {
+		return t
+	}
+	return c
+}
+
+// overrideOsModule routes os.getenv, os.time and os.date through Getenv and
+// Now of this Context.
+func (c *Context) overrideOsModule() {
+	L := c.getL()
+	osm, ok := L.GetGlobal("os").(*lua.LTable)
+	if !ok {
+		return
+	}
+	origTime := osm.RawGetString("time")
+	origDate := osm.RawGetString("date")
+
+	L.SetField(osm, "getenv", L.NewFunction(func(L *lua.LState) int {
+		if v, ok := c.Getenv(L.CheckString(1)); ok {
+			L.Push(lua.LString(v))
+		} else {
+			L.Push(lua.LNil)
+		}
+		return 1
+	}))
+
+	L.SetField(osm, "time", L.NewFunction(func(L *lua.LState) int {
+		if L.GetTop() > 0 {
+			// Converting a given date table does not depend on the clock.
+			L.Push(origTime)
+			L.Push(L.Get(1))
+			L.Call(1, 1)
+			return 1
+		}
+		L.Push(lua.LNumber(c.Now().Unix()))
+		return 1
+	}))
+
+	L.SetField(osm, "date", L.NewFunction(func(L *lua.LState) int {
+		format := L.OptString(1, "%c")
+		var at lua.LValue = lua.LNumber(c.Now().Unix())
+		if L.GetTop() > 1 {
+			at = L.Get(2)
+		}
+		L.Push(origDate)
+		L.Push(lua.LString(format))
+		L.Push(at)
+		L.Call(2, 1)
+		return 1
+	}))
+}
@@ -0,0 +1,44 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+var DefaultPluginPath = ".."
+
+// GivenPluginContext creates a Context (see GivenContext) with the PLUGIN
+// global of DefaultPluginPath loaded; this is its metadata.lua and all of its
+// hooks.
+func GivenPluginContext(t testing.TB) *Context {
+	t.Helper()
+	c := GivenContext(t)
+	if err := c.LoadPlugin(DefaultPluginPath); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// LoadPlugin executes the metadata.lua and all hooks/*.lua of the plugin
+// inside the given path.
+func (c *Context) LoadPlugin(path string) error {
+	if err := c.doFile(filepath.Join(path, "metadata.lua")); err != nil {
+		return fmt.Errorf("cannot load metadata of plugin %q: %w", path, err)
+	}
+
+	hooks, err := filepath.Glob(filepath.Join(path, "hooks", "*.lua"))
+	if err != nil {
+		return fmt.Errorf("cannot list hooks of plugin %q: %w", path, err)
+	}
+	for _, hook := range hooks {
+		if err := c.doFile(hook); err != nil {
+			return fmt.Errorf("cannot load hook %q: %w", hook, err)
+		}
+	}
+
+	c.setup(func(c *Context) error {
+		return c.LoadPlugin(path)
+	})
+	return nil
+}
@@ -3,11 +3,16 @@
 package test
 
 import (
+	"net"
 	"os"
+	"os/exec"
 	"os/user"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -47,3 +52,171 @@ func TestE2E_vfox_install(t *testing.T) {
 
 	ShouldExec(t, 0, "vfox", "install", "mongod@8.2.1")
 }
+
+// givenFreePort returns a port on 127.0.0.1 which is currently not in use.
+func givenFreePort(t testing.TB) int {
+	t.Helper()
+	return givenFreePorts(t, 1)
+}
+
+// givenFreePorts returns the first of n consecutive ports on 127.0.0.1 which
+// are currently not in use.
+func givenFreePorts(t testing.TB, n int) int {
+	t.Helper()
+	for attempt := 0; attempt < 20; attempt++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		port := ln.Addr().(*net.TCPAddr).Port
+		lns := []net.Listener{ln}
+		for i := 1; i < n && lns != nil; i++ {
+			if ln, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port+i)); err == nil {
+				lns = append(lns, ln)
+			} else {
+				lns = nil
+			}
+		}
+		free := lns != nil
+		for _, ln := range lns {
+			_ = ln.Close()
+		}
+		if free {
+			return port
+		}
+		_ = ln.Close()
+	}
+	require.FailNow(t, "Should find consecutive free ports.", "n=%d", n)
+	return 0
+}
+
+func TestE2E_instance_lifecycle(t *testing.T) {
+	tc, fs := givenInstallContext(t, installChecksumsCorrect)
+	GivenStubMongod(t, fs.Path("install"))
+	// The generated files have to cope with every character of a path.
+	project := fs.Path(`pro|ject & "co\\`)
+	require.NoError(t, os.MkdirAll(project, 0755))
+	port := strconv.Itoa(givenFreePort(t))
+
+	tc.ShouldEvaluateTo(t, `return PLUGIN:PostInstall({sdkInfo = {mongod = {path = [[`+fs.Path("install")+`]], version = "`+installVersion+`"}}})`, nil)
+
+	instance := func(action string) *exec.Cmd {
+		cmd := exec.Command(fs.Path("install", "bin", "mongod-instance"), action)
+		cmd.Dir = project
+		cmd.Env = append(os.Environ(), "MISE_PROJECT_ROOT="+project, "MONGOD_PORT="+port)
+		return cmd
+	}
+	dir := filepath.Join(project, ".mise", "mongod")
+	t.Cleanup(func() {
+		_, _ = ExecCommand(t, instance("stop"))
+	})
+
+	assert.Equal(t, "mongod is not running.", ShouldExecCommand(t, 3, instance("status")))
+
+	assert.Regexp(t, `^mongod started \(pid \d+, port `+port+`, data `+regexp.QuoteMeta(dir)+`/data\)\.$`, ShouldExecCommand(t, 0, instance("start")))
+	conn, err := net.Dial("tcp", "127.0.0.1:"+port)
+	require.NoError(t, err, "mongod should accept connections once started.")
+	_ = conn.Close()
+	assert.Regexp(t, `^mongod is running \(pid \d+, port `+port+`, data `+regexp.QuoteMeta(dir)+`/data\)\.$`, ShouldExecCommand(t, 0, instance("status")))
+	assert.Regexp(t, `^mongod is already running \(pid \d+\)\.$`, ShouldExecCommand(t, 0, instance("start")))
+	assert.DirExists(t, filepath.Join(dir, "data"))
+
+	conf, err := os.ReadFile(filepath.Join(dir, "mongod.conf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(conf), `dbPath: `+strconv.Quote(dir+"/data"))
+	assert.Contains(t, string(conf), `path: `+strconv.Quote(dir+"/mongod.log"))
+	assert.Contains(t, string(conf), `bindIp: "127.0.0.1"`)
+	assert.Contains(t, string(conf), "port: "+port)
+
+	assert.Regexp(t, `^mongod stopped \(pid \d+\)\.$`, ShouldExecCommand(t, 0, instance("stop")))
+	assert.Equal(t, "mongod is not running.", ShouldExecCommand(t, 3, instance("status")))
+	assert.Equal(t, "mongod is not running.", ShouldExecCommand(t, 0, instance("stop")))
+	assert.NoFileExists(t, filepath.Join(dir, "mongod.pid"))
+
+	t.Run("portInUse", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:"+port)
+		require.NoError(t, err)
+		defer func() { _ = ln.Close() }()
+
+		output := ShouldExecCommand(t, 1, instance("start"))
+		assert.Contains(t, output, "exited during start.")
+		assert.Contains(t, output, "Error setting up listener")
+		assert.NoFileExists(t, filepath.Join(dir, "mongod.pid"))
+		assert.Equal(t, "mongod is not running.", ShouldExecCommand(t, 3, instance("status")))
+	})
+
+	assert.Contains(t, ShouldExecCommand(t, 2, instance("restart")), "Usage: mongod-instance start|stop|status")
+}
+
+func TestE2E_replset_lifecycle(t *testing.T) {
+	tc, fs := givenInstallContext(t, installChecksumsCorrect)
+	GivenStubMongod(t, fs.Path("install"))
+	project := fs.Path(`pro|ject & "co\\`)
+	require.NoError(t, os.MkdirAll(project, 0755))
+	port := givenFreePorts(t, 3)
+	evalLog := fs.Path("mongosh.log")
+
+	tc.ShouldEvaluateTo(t, `return PLUGIN:PostInstall({sdkInfo = {mongod = {path = [[`+fs.Path("install")+`]], version = "`+installVersion+`"}}})`, nil)
+
+	replset := func(action string) *exec.Cmd {
+		cmd := exec.Command(fs.Path("install", "bin", "mongod-replset"), action)
+		cmd.Dir = project
+		cmd.Env = append(os.Environ(),
+			"MISE_PROJECT_ROOT="+project,
+			"MONGOD_REPLSET_MEMBERS=3",
+			"MONGOD_REPLSET_PORT="+strconv.Itoa(port),
+			"MONGOD_REPLSET_HOST=localhost",
+			"MONGOSH_STUB_EVAL_LOG="+evalLog,
+		)
+		return cmd
+	}
+	dir := filepath.Join(project, ".mise", "mongod-replset")
+	t.Cleanup(func() {
+		_, _ = ExecCommand(t, replset("stop"))
+	})
+
+	assert.Equal(t, "Member 1 is not running.\nMember 2 is not running.\nMember 3 is not running.", ShouldExecCommand(t, 3, replset("status")))
+
+	assert.Equal(t, "ok\nReplica set rs0 is running (3 members, ports "+strconv.Itoa(port)+" to "+strconv.Itoa(port+2)+", data "+dir+").", ShouldExecCommand(t, 0, replset("start")))
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port+i))
+		require.NoError(t, err, "Member %d should accept connections once started.", i+1)
+		_ = conn.Close()
+	}
+	assert.Regexp(t, `^Member 1 is running \(pid \d+, port `+strconv.Itoa(port)+`\)\.\nMember 2 is running .+\nMember 3 is running .+$`, ShouldExecCommand(t, 0, replset("status")))
+
+	initiated, err := os.ReadFile(evalLog)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:"+strconv.Itoa(port)+` try { rs.status() } catch (e) { rs.initiate({_id: "rs0", members: [`+
+		`{_id: 0, host: "localhost:`+strconv.Itoa(port)+`"}, `+
+		`{_id: 1, host: "localhost:`+strconv.Itoa(port+1)+`"}, `+
+		`{_id: 2, host: "localhost:`+strconv.Itoa(port+2)+`"}]}) }`+"\n", string(initiated))
+
+	keyfile := filepath.Join(dir, "keyfile")
+	fi, err := os.Stat(keyfile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	key, err := os.ReadFile(keyfile)
+	require.NoError(t, err)
+	assert.Regexp(t, `^[A-Za-z0-9+/]{756}$`, string(key))
+
+	conf, err := os.ReadFile(filepath.Join(dir, "member2", "mongod.conf"))
+	require.NoError(t, err)
+	assert.Contains(t, string(conf), `dbPath: `+strconv.Quote(dir+"/member2/data"))
+	assert.Contains(t, string(conf), `bindIp: "127.0.0.1"`)
+	assert.Contains(t, string(conf), `keyFile: `+strconv.Quote(keyfile))
+	assert.Equal(t, "mongodb://localhost:"+strconv.Itoa(port)+",localhost:"+strconv.Itoa(port+1)+",localhost:"+strconv.Itoa(port+2)+"/?replicaSet=rs0", ShouldExecCommand(t, 0, replset("uri")))
+
+	// Running members are neither started nor initiated again.
+	ShouldExecCommand(t, 0, replset("start"))
+	initiatedAgain, err := os.ReadFile(evalLog)
+	require.NoError(t, err)
+	assert.Equal(t, string(initiated), string(initiatedAgain))
+	keyAgain, err := os.ReadFile(keyfile)
+	require.NoError(t, err)
+	assert.Equal(t, string(key), string(keyAgain), "The key file should be kept.")
+
+	assert.Regexp(t, `^Member 1 stopped \(pid \d+\)\.\nMember 2 stopped \(pid \d+\)\.\nMember 3 stopped \(pid \d+\)\.$`, ShouldExecCommand(t, 0, replset("stop")))
+	ShouldExecCommand(t, 3, replset("status"))
+	assert.Equal(t, "", ShouldExecCommand(t, 0, replset("stop")))
+
+	assert.Contains(t, ShouldExecCommand(t, 2, replset("restart")), "Usage: mongod-replset start|stop|status|uri")
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvKeys(t *testing.T) {
+	dir := t.TempDir()
+	env := func(key, value string) map[string]any {
+		return map[string]any{"key": key, "value": value}
+	}
+
+	cases := []struct {
+		name     string
+		ctx      string
+		env      map[string]string
+		expected []any
+	}{{
+		name: "vfox",
+		ctx:  `{path = [[` + dir + `]], main = {name = "mongod", path = [[` + dir + `]], version = "8.0.9"}, sdkInfo = {mongod = {name = "mongod", path = [[` + dir + `]], version = "8.0.9"}}}`,
+		expected: []any{
+			env("PATH", dir+"/bin"),
+			env("MONGOD_HOME", dir),
+			env("MONGOD_VERSION", "8.0.9"),
+		},
+	}, {
+		name: "sdkInfoOnly",
+		ctx:  `{path = [[` + dir + `]], sdkInfo = {mongod = {path = [[` + dir + `]], version = "8.0.9"}}}`,
+		expected: []any{
+			env("PATH", dir+"/bin"),
+			env("MONGOD_HOME", dir),
+			env("MONGOD_VERSION", "8.0.9"),
+		},
+	}, {
+		name: "versionOnly",
+		ctx:  `{path = [[` + dir + `]], version = "8.0.9"}`,
+		expected: []any{
+			env("PATH", dir+"/bin"),
+			env("MONGOD_HOME", dir),
+			env("MONGOD_VERSION", "8.0.9"),
+		},
+	}, {
+		name: "withoutVersion",
+		ctx:  `{path = [[` + dir + `]]}`,
+		expected: []any{
+			env("PATH", dir+"/bin"),
+			env("MONGOD_HOME", dir),
+		},
+	}, {
+		name: "details",
+		ctx:  `{path = [[` + dir + `]], version = "8.0.9"}`,
+		env:  map[string]string{"MONGOD_EXPORT_DETAILS": "1"},
+		expected: []any{
+			env("PATH", dir+"/bin"),
+			env("MONGOD_HOME", dir),
+			env("MONGOD_VERSION", "8.0.9"),
+			env("MONGOD_EDITION_RESOLVED", "community"),
+			env("MONGOD_TARGET_RESOLVED", "ubuntu2404"),
+		},
+	}, {
+		name: "detailsEnterprise",
+		ctx:  `{path = [[` + dir + `]], version = "8.0.9"}`,
+		env:  map[string]string{"MONGOD_EXPORT_DETAILS": "1", "MONGOD_EDITION": "enterprise", "MONGOD_TARGET": "rhel93"},
+		expected: []any{
+			env("PATH", dir+"/bin"),
+			env("MONGOD_HOME", dir),
+			env("MONGOD_VERSION", "8.0.9"),
+			env("MONGOD_EDITION_RESOLVED", "enterprise"),
+			env("MONGOD_TARGET_RESOLVED", "rhel93"),
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc := GivenPluginContext(t)
+			tc.OsType = "linux"
+			tc.DistributionType = "ubuntu"
+			tc.DistributionVersion = "24.4"
+			for k, v := range c.env {
+				tc.Setenv(k, v)
+			}
+
+			tc.ShouldEvaluateTo(t, `return PLUGIN:EnvKeys(`+c.ctx+`)`, c.expected)
+		})
+	}
+
+	t.Run("detailsWithIllegalEdition", func(t *testing.T) {
+		tc := GivenPluginContext(t)
+		tc.OsType = "linux"
+		tc.DistributionType = "ubuntu"
+		tc.DistributionVersion = "24.4"
+		tc.Setenv("MONGOD_EXPORT_DETAILS", "1")
+		tc.Setenv("MONGOD_EDITION", "foo")
+
+		tc.ShouldEvaluateTo(t, `return PLUGIN:EnvKeys({path = [[`+dir+`]], version = "8.0.9"})`, []any{
+			env("PATH", dir+"/bin"),
+			env("MONGOD_HOME", dir),
+			env("MONGOD_VERSION", "8.0.9"),
+			env("MONGOD_TARGET_RESOLVED", "ubuntu2404"),
+		})
+		require.Len(t, tc.LogsMatching("Unsupported edition: foo"), 1)
+	})
+
+	t.Run("withCompanions", func(t *testing.T) {
+		tc := GivenPluginContext(t)
+		tc.OsType = "linux"
+		dir := t.TempDir()
+		for _, fn := range []string{
+			filepath.Join(dir, "mongosh", "bin", "mongosh"),
+			filepath.Join(dir, "database-tools", "bin", "mongodump"),
+		} {
+			require.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+			require.NoError(t, os.WriteFile(fn, nil, 0755))
+		}
+
+		tc.ShouldEvaluateTo(t, `return PLUGIN:EnvKeys({path = [[`+dir+`]], version = "8.0.9"})`, []any{
+			env("PATH", dir+"/bin"),
+			env("PATH", filepath.Join(dir, "mongosh", "bin")),
+			env("PATH", filepath.Join(dir, "database-tools", "bin")),
+			env("MONGOD_HOME", dir),
+			env("MONGOD_VERSION", "8.0.9"),
+		})
+	})
+}
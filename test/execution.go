@@ -13,29 +13,36 @@ import (
 
 func Exec(t testing.TB, prg string, args ...string) (string, int) {
 	t.Helper()
-	HookLogger(t)
 
 	path, err := exec.LookPath(prg)
 	require.NoError(t, err, "Should be able to find %s executable in PATH.", prg)
 
-	var output bytes.Buffer
+	return ExecCommand(t, exec.Command(path, args...))
+}
 
-	cmd := exec.Command(path, args...)
+// ExecCommand runs the given command (which can be prepared with a custom
+// working directory and environment) and returns its combined output and its
+// exit code.
+func ExecCommand(t testing.TB, cmd *exec.Cmd) (string, int) {
+	t.Helper()
+	HookLogger(t)
+
+	var output bytes.Buffer
 	cmd.Stdout = &output
 	cmd.Stderr = &output
 
-	err = cmd.Run()
+	err := cmd.Run()
 	var exitErr *exec.ExitError
 	var exitCode int
 	if errors.As(err, &exitErr) {
 		exitCode = exitErr.ExitCode()
 	} else {
-		require.NoError(t, err, "Should be able to run %s without error.", prg)
+		require.NoError(t, err, "Should be able to run %s without error.", cmd.Path)
 	}
 
 	result := strings.TrimSpace(output.String())
 	if result != "" {
-		log.With("cmd", append([]string{"mise"}, args...)).
+		log.With("cmd", cmd.Args).
 			With("exitCode", exitCode).
 			Trace(result)
 	}
@@ -52,6 +59,16 @@ func ShouldExec(t testing.TB, expectedCode int, prg string, args ...string) stri
 	return output
 }
 
+func ShouldExecCommand(t testing.TB, expectedCode int, cmd *exec.Cmd) string {
+	t.Helper()
+	output, code := ExecCommand(t, cmd)
+	if code != expectedCode {
+		t.Errorf("stdout/stderr:\n%s", output)
+		require.Equal(t, expectedCode, code, "%v should exit with %d", cmd.Args, expectedCode)
+	}
+	return output
+}
+
 func ShouldMatching(t testing.TB, expectedCode int, contentMatching string, prg string, args ...string) {
 	t.Helper()
 	output := ShouldExec(t, expectedCode, prg, args...)
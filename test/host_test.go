@@ -0,0 +1,64 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHost_extract_windows(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/host.lua")
+	tc.OsType = "windows"
+	tc.GivenCommandOutput(`^tar `, "", 0)
+
+	cases := []struct {
+		name        string
+		archive     string
+		destination string
+		expected    string
+	}{
+		{"plain", `C:\Users\foo\mongosh.zip`, `C:\Users\foo`, `tar -xf "C:\Users\foo\mongosh.zip" -C "C:\Users\foo"`},
+		{"spaces", `C:\Program Files\mongosh.zip`, `C:\Program Files\`, `tar -xf "C:\Program Files\mongosh.zip" -C "C:\Program Files\\"`},
+		{"quotes", `C:\foo"bar\mongosh.zip`, `C:\foo\"bar`, `tar -xf "C:\foo\"bar\mongosh.zip" -C "C:\foo\\\"bar"`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc.ResetCommands()
+			tc.ShouldEvaluateTo(t, `t.extract([[`+c.archive+`]], [[`+c.destination+`]])
+return nil`, nil)
+			tc.ShouldHaveExecuted(t, c.expected+" 2>&1")
+		})
+	}
+}
+
+func TestHost_list_dir(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/host.lua")
+	tc.OsType = "linux"
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "it's"), nil, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), nil, 0600))
+
+	tc.ShouldEvaluateTo(t, `local r = t.list_dir([[`+dir+`]]); table.sort(r); return table.concat(r, ",")`, ".hidden,it's")
+	tc.ShouldEvaluateTo(t, `return #t.list_dir([[`+filepath.Join(dir, "missing")+`]])`, float64(0))
+}
+
+func TestHost_list_dir_failing(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/host.lua")
+	tc.OsType = "linux"
+	tc.GivenCommandOutput(`^if \[ -d `, "ls: cannot open directory: Permission denied", 2)
+
+	tc.ShouldEvaluateToError(t, `return t.list_dir("/foo/it's")`, "Permission denied")
+	tc.ShouldHaveExecuted(t, `if [ -d '/foo/it'\''s' ]; then ls -1A '/foo/it'\''s'; fi 2>&1`)
+}
+
+func TestHost_list_dir_windows(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/host.lua")
+	tc.OsType = "windows"
+	tc.GivenCommandOutput(`^powershell `, "a\r\nb\r\n", 0)
+
+	tc.ShouldEvaluateTo(t, `return table.concat(t.list_dir([[C:\it's]]), ",")`, "a,b")
+	tc.ShouldHaveExecuted(t, `powershell -NoProfile -Command "if (Test-Path -LiteralPath 'C:\it''s' -PathType Container) { Get-ChildItem -Name -Force -LiteralPath 'C:\it''s' }" 2>&1`)
+}
@@ -0,0 +1,205 @@
+package test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	installVersion     = "8.0.9"
+	installArchiveName = "mongodb-linux-x86_64-ubuntu2404-" + installVersion + ".tgz"
+)
+
+// stubMongod is the script of a bin/mongod which reports its version (if
+// called with -version) or otherwise prints its arguments and runs until it
+// gets terminated.
+const stubMongod = `case "$1" in
+-version|--version) echo "db version v` + installVersion + `" ;;
+*) echo "$@"; exec sleep 600 ;;
+esac`
+
+// givenMongodArchive creates a .tgz archive like the ones of
+// fastdl.mongodb.org, which contains the stubMongod as bin/mongod.
+func givenMongodArchive() []byte {
+	return givenTgzArchive("mongodb-linux-x86_64-ubuntu2404-"+installVersion, map[string]string{
+		"mongod": stubMongod,
+	})
+}
+
+// givenInstalledMongod extracts the archive of givenMongodArchive into the
+// given directory, like the runtime does before PostInstall.
+func givenInstalledMongod(t testing.TB, dir string) {
+	t.Helper()
+	fn := filepath.Join(dir, "bin", "mongod")
+	require.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+	require.NoError(t, os.WriteFile(fn, []byte("#!/bin/sh\n"+stubMongod+"\n"), 0755))
+}
+
+// givenTgzArchive creates a .tgz archive which contains the directory base
+// with a bin directory inside, which contains the given executables (name to
+// shell script).
+func givenTgzArchive(base string, executables map[string]string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	write := func(h *tar.Header, content []byte) {
+		if err := tw.WriteHeader(h); err != nil {
+			panic(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			panic(err)
+		}
+	}
+
+	write(&tar.Header{Name: base + "/", Typeflag: tar.TypeDir, Mode: 0755}, nil)
+	write(&tar.Header{Name: base + "/bin/", Typeflag: tar.TypeDir, Mode: 0755}, nil)
+	names := make([]string, 0, len(executables))
+	for name := range executables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		content := []byte("#!/bin/sh\n" + executables[name] + "\n")
+		write(&tar.Header{Name: base + "/bin/" + name, Typeflag: tar.TypeReg, Mode: 0755, Size: int64(len(content))}, content)
+	}
+
+	if err := tw.Close(); err != nil {
+		panic(err)
+	}
+	if err := gw.Close(); err != nil {
+		panic(err)
+	}
+
+	return buf.Bytes()
+}
+
+var (
+	installArchive = givenMongodArchive()
+
+	installChecksumsCorrect = func(string) (string, string) {
+		sha1Sum, sha256Sum := sha1.Sum(installArchive), sha256.Sum256(installArchive)
+		return hex.EncodeToString(sha1Sum[:]), hex.EncodeToString(sha256Sum[:])
+	}
+	installChecksumsSha1Only = func(url string) (string, string) {
+		sha1Sum, _ := installChecksumsCorrect(url)
+		return sha1Sum, ""
+	}
+	installChecksumsWrong = func(string) (string, string) {
+		return "0000000000000000000000000000000000000000", "0000000000000000000000000000000000000000000000000000000000000000"
+	}
+	installChecksumsMissing = func(string) (string, string) {
+		return "", ""
+	}
+)
+
+// givenInstallContext creates a plugin context for linux/ubuntu2404/x86_64
+// which offers installVersion with the given checksums.
+func givenInstallContext(t testing.TB, checksums func(url string) (sha1, sha256 string)) (*Context, *Filesystem) {
+	t.Helper()
+	tc := GivenPluginContext(t)
+	tc.OsType = "linux"
+	tc.DistributionType = "ubuntu"
+	tc.DistributionVersion = "24.4"
+	fs := tc.GivenFilesystem(t)
+
+	tc.HTTP().GivenFixtureBody(versionsUrl, givenFullJson(
+		givenFullJsonVersion{version: installVersion, production: true, lts: true, checksums: checksums},
+	))
+
+	return tc, fs
+}
+
+func TestPreInstall_checksums(t *testing.T) {
+	sha1Sum, sha256Sum := installChecksumsCorrect("")
+
+	cases := []struct {
+		name      string
+		checksums func(url string) (sha1, sha256 string)
+		strict    string
+		expected  any
+		err       string
+	}{
+		{"sha256", installChecksumsCorrect, "", []any{sha256Sum, ""}, ""},
+		{"sha1Only", installChecksumsSha1Only, "", []any{"", sha1Sum}, ""},
+		{"missing", installChecksumsMissing, "", []any{"", ""}, ""},
+		{"sha256Strict", installChecksumsCorrect, "1", []any{sha256Sum, ""}, ""},
+		{"sha1OnlyStrict", installChecksumsSha1Only, "1", []any{"", sha1Sum}, ""},
+		{"missingStrict", installChecksumsMissing, "1", nil, "refusing to install it because MONGOD_STRICT_CHECKSUMS is set."},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc, _ := givenInstallContext(t, c.checksums)
+			tc.Setenv("MONGOD_STRICT_CHECKSUMS", c.strict)
+
+			script := `local result = PLUGIN:PreInstall({version = "` + installVersion + `"})
+return {result.sha256 or "", result.sha1 or ""}`
+			if c.err != "" {
+				tc.ShouldEvaluateToError(t, script, c.err)
+			} else {
+				tc.ShouldEvaluateTo(t, script, c.expected)
+			}
+		})
+	}
+}
+
+func TestPostInstall_verifiesArchive(t *testing.T) {
+	cases := []struct {
+		name      string
+		checksums func(url string) (sha1, sha256 string)
+		strict    string
+		err       string
+	}{
+		{"sha256", installChecksumsCorrect, "", ""},
+		{"sha1Only", installChecksumsSha1Only, "", ""},
+		{"missing", installChecksumsMissing, "", ""},
+		{"wrong", installChecksumsWrong, "", "Checksum mismatch of "},
+		{"missingStrict", installChecksumsMissing, "1", "There is no known checksum of "},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc, fs := givenInstallContext(t, c.checksums)
+			tc.GivenMise()
+			tc.Setenv("MONGOD_STRICT_CHECKSUMS", c.strict)
+			_, _ = tc.Evaluate(`return PLUGIN:PreInstall({version = "` + installVersion + `"})`)
+			// PostInstall should not need the versions anymore.
+			tc.ShouldEvaluate(t, `return require("versions").invalidate_caches()`)
+			tc.Setenv("MONGOD_OFFLINE", "1")
+			// MISE prior 2025.10.8 leaves the .tgz unextracted in the installation.
+			require.NoError(t, os.MkdirAll(fs.Path("install"), 0755))
+			require.NoError(t, os.WriteFile(fs.Path("install", installArchiveName), installArchive, 0644))
+
+			script := `return PLUGIN:PostInstall({sdkInfo = {mongod = {path = [[` + fs.Path("install") + `]], version = "` + installVersion + `"}}})`
+			if c.err != "" {
+				tc.ShouldEvaluateToError(t, script, c.err)
+				assert.True(t, fs.Exists(filepath.Join("install", installArchiveName)), "Unverified archive should stay untouched.")
+				assert.False(t, fs.Exists(filepath.Join("install", "bin", "mongod")), "Unverified archive should not be extracted.")
+			} else {
+				tc.ShouldEvaluateTo(t, script, nil)
+				assert.False(t, fs.Exists(filepath.Join("install", installArchiveName)), "Archive should be removed.")
+				assert.True(t, fs.Exists(filepath.Join("install", "bin", "mongod")), "Archive should be extracted.")
+			}
+		})
+	}
+}
+
+func TestPostInstall_brokenInstallation(t *testing.T) {
+	tc, fs := givenInstallContext(t, installChecksumsCorrect)
+	require.NoError(t, os.MkdirAll(fs.Path("install"), 0755))
+
+	tc.ShouldEvaluateToError(t, `return PLUGIN:PostInstall({sdkInfo = {mongod = {path = [[`+fs.Path("install")+`]], version = "`+installVersion+`"}}})`,
+		"mongod installation appears to be broken: "+fs.Path("install", "bin", "mongod")+" does not exist")
+}
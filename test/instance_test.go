@@ -0,0 +1,43 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstance_install(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/instance.lua")
+	tc.OsType = "linux"
+	dir := t.TempDir()
+	givenInstalledMongod(t, dir)
+
+	tc.ShouldEvaluateTo(t, `return t.install([[`+dir+`]], "8.0.9")`, nil)
+
+	template, err := os.ReadFile(filepath.Join(dir, "instance", "mongod.conf.template"))
+	require.NoError(t, err)
+	assert.Contains(t, string(template), "# Generated by vfox-mongod for mongod 8.0.9.")
+	assert.Contains(t, string(template), `dbPath: "@DBPATH@"`)
+	assert.Contains(t, string(template), "port: @PORT@")
+
+	fi, err := os.Stat(filepath.Join(dir, "bin", "mongod-instance"))
+	require.NoError(t, err)
+	assert.NotZero(t, fi.Mode()&0100, "mongod-instance should be executable.")
+	script, err := os.ReadFile(filepath.Join(dir, "bin", "mongod-instance"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(script), "@SHELL_FUNCTIONS@")
+	assert.Contains(t, string(script), "running_pid() {")
+}
+
+func TestInstance_windows(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/instance.lua")
+	tc.OsType = "windows"
+	dir := t.TempDir()
+
+	tc.ShouldEvaluateTo(t, `return t.install([[`+dir+`]], "8.0.9")`, nil)
+	assert.NoDirExists(t, filepath.Join(dir, "instance"))
+	assert.NoFileExists(t, filepath.Join(dir, "bin", "mongod-instance"))
+}
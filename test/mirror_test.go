@@ -0,0 +1,111 @@
+package test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// givenMirror starts a mirror (like an Artifactory) of downloads.mongodb.org
+// and fastdl.mongodb.org, which serves the full.json below /mongodb/ and all
+// archives with the path of their original url below /mongodb/.
+func givenMirror(t testing.TB, fullJson []byte, archives map[string][]byte) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mongodb/", func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, "/mongodb")
+		if p == "/full.json" {
+			_, _ = w.Write(fullJson)
+			return
+		}
+		if archive, ok := archives[p]; ok {
+			_, _ = w.Write(archive)
+			return
+		}
+		http.NotFound(w, r)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVersions___mirror(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/versions.lua")
+
+	cases := []struct {
+		base     string
+		url      string
+		expected string
+	}{
+		{"", "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz", "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz"},
+		{"https://artifactory.example.com/mongodb", "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz", "https://artifactory.example.com/mongodb/linux/mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz"},
+		{"https://artifactory.example.com/mongodb/", "https://downloads.mongodb.com/windows/mongodb-windows-x86_64-enterprise-8.0.9.zip", "https://artifactory.example.com/mongodb/windows/mongodb-windows-x86_64-enterprise-8.0.9.zip"},
+		{"http://localhost:8080", "https://fastdl.mongodb.org/tools/db/mongodb-database-tools-ubuntu2404-x86_64-100.13.0.tgz", "http://localhost:8080/tools/db/mongodb-database-tools-ubuntu2404-x86_64-100.13.0.tgz"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.base, func(t *testing.T) {
+			tc.Setenv("MONGOD_DOWNLOAD_BASE_URL", c.base)
+			tc.ShouldEvaluateTo(t, `return t.__mirror("`+c.url+`")`, c.expected)
+		})
+	}
+}
+
+func TestVersions_get_cacheOfOtherFeed(t *testing.T) {
+	tc, fs := givenVersionsContext(t)
+	givenVersionsCache(t, fs, `{"format":2,"created":`+versionsExpired+`,"versions":{"7.0.0":{"url":"https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2404-7.0.0.tgz"}}}`)
+	srv := givenMirror(t, givenFullJson(givenFullJsonVersion{version: "8.0.9", production: true}), nil)
+	tc.Setenv("MONGOD_VERSIONS_URL", srv.URL+"/mongodb/full.json")
+	tc.Setenv("MONGOD_OFFLINE", "1")
+
+	tc.ShouldEvaluateToError(t, `return t.get("7.0.0")`, "MONGOD_OFFLINE is set, but there are no cached versions in ")
+
+	tc.Setenv("MONGOD_OFFLINE", "")
+	tc.ShouldEvaluateTo(t, `return t.get("8.0.9").version`, "8.0.9")
+	assert.Equal(t, srv.URL+"/mongodb/full.json", readVersionsCache(t, fs)["url"])
+	tc.HTTP().ShouldNotHaveRequested(t, versionsUrl)
+}
+
+func TestPreInstall_mirror(t *testing.T) {
+	archivePath := "/linux/" + installArchiveName
+	srv := givenMirror(t, givenFullJson(
+		givenFullJsonVersion{version: installVersion, production: true, lts: true, checksums: installChecksumsCorrect},
+	), map[string][]byte{
+		archivePath: installArchive,
+	})
+	tc, fs := givenInstallContext(t, installChecksumsCorrect)
+	tc.Setenv("MONGOD_VERSIONS_URL", srv.URL+"/mongodb/full.json")
+	tc.Setenv("MONGOD_DOWNLOAD_BASE_URL", srv.URL+"/mongodb")
+
+	result := tc.ShouldEvaluate(t, `return PLUGIN:PreInstall({version = "lts"})`).(map[string]any)
+	require.Equal(t, installVersion, result["version"])
+	require.Equal(t, srv.URL+"/mongodb"+archivePath, result["url"])
+	sha256Sum := sha256.Sum256(installArchive)
+	require.Equal(t, hex.EncodeToString(sha256Sum[:]), result["sha256"], "Checksum of the original archive should be kept.")
+
+	// Now do what the runtime does with the result of PreInstall...
+	install := fs.Path("install")
+	require.NoError(t, os.MkdirAll(install, 0755))
+	archive := filepath.Join(install, installArchiveName)
+	tc.ShouldEvaluateTo(t, `return require("http").download_file({url = "`+result["url"].(string)+`"}, [[`+archive+`]])`, nil)
+	downloaded, err := os.ReadFile(archive)
+	require.NoError(t, err)
+	downloadedSum := sha256.Sum256(downloaded)
+	require.Equal(t, result["sha256"], hex.EncodeToString(downloadedSum[:]))
+
+	// ...and let MISE (which does not extract .tgz) finish the installation.
+	tc.GivenMise()
+	tc.ShouldEvaluateTo(t, `return PLUGIN:PostInstall({sdkInfo = {mongod = {path = [[`+install+`]], version = "`+installVersion+`"}}})`, nil)
+	assert.True(t, fs.Exists(filepath.Join("install", "bin", "mongod")))
+
+	tc.HTTP().ShouldNotHaveRequested(t, versionsUrl)
+	tc.HTTP().ShouldOnlyHaveRequestedHosts(t, srv.Listener.Addr().String())
+}
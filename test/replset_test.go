@@ -0,0 +1,308 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var replsetEnvKeys = []string{"MONGOD_REPLSET_MEMBERS", "MONGOD_REPLSET_NAME", "MONGOD_REPLSET_PORT", "MONGOD_REPLSET_HOST", "MONGOD_REPLSET_DIR", "MONGOD_BIND_IP", "MISE_PROJECT_ROOT"}
+
+// givenReplsetEnv sets the given variables of replsetEnvKeys for the given
+// Context and empties all others (which counts as unset).
+func givenReplsetEnv(tc *Context, env map[string]string) {
+	for _, key := range replsetEnvKeys {
+		tc.Setenv(key, env[key])
+	}
+}
+
+func TestReplset_config(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/replset.lua")
+
+	cases := []struct {
+		name     string
+		env      map[string]string
+		expected any
+		err      string
+	}{
+		{"disabled", map[string]string{}, nil, ""},
+		{"zero", map[string]string{"MONGOD_REPLSET_MEMBERS": "0"}, nil, ""},
+		{"defaults", map[string]string{"MONGOD_REPLSET_MEMBERS": "3", "MISE_PROJECT_ROOT": "/project"}, map[string]any{
+			"name": "rs0", "members": float64(3), "port": float64(27018), "host": "127.0.0.1", "bind_ip": "127.0.0.1", "dir": "/project/.mise/mongod-replset",
+		}, ""},
+		{"custom", map[string]string{"MONGOD_REPLSET_MEMBERS": "1", "MONGOD_REPLSET_NAME": "dev", "MONGOD_REPLSET_PORT": "28000", "MONGOD_REPLSET_HOST": "dev.example.com", "MONGOD_BIND_IP": "0.0.0.0", "MONGOD_REPLSET_DIR": "/data/rs"}, map[string]any{
+			"name": "dev", "members": float64(1), "port": float64(28000), "host": "dev.example.com", "bind_ip": "0.0.0.0", "dir": "/data/rs",
+		}, ""},
+		{"leadingZeros", map[string]string{"MONGOD_REPLSET_MEMBERS": "03", "MONGOD_REPLSET_PORT": "027018", "MISE_PROJECT_ROOT": "/project"}, map[string]any{
+			"name": "rs0", "members": float64(3), "port": float64(27018), "host": "127.0.0.1", "bind_ip": "127.0.0.1", "dir": "/project/.mise/mongod-replset",
+		}, ""},
+		{"tooMany", map[string]string{"MONGOD_REPLSET_MEMBERS": "8"}, nil, "MONGOD_REPLSET_MEMBERS must be a number between 1 and 7, but is 8."},
+		{"illegal", map[string]string{"MONGOD_REPLSET_MEMBERS": "three"}, nil, "MONGOD_REPLSET_MEMBERS must be a number between 1 and 7, but is three."},
+		{"fraction", map[string]string{"MONGOD_REPLSET_MEMBERS": "3.0"}, nil, "MONGOD_REPLSET_MEMBERS must be a number between 1 and 7, but is 3.0."},
+		{"hex", map[string]string{"MONGOD_REPLSET_MEMBERS": "0x3"}, nil, "MONGOD_REPLSET_MEMBERS must be a number between 1 and 7, but is 0x3."},
+		{"illegalPort", map[string]string{"MONGOD_REPLSET_MEMBERS": "3", "MONGOD_REPLSET_PORT": "high"}, nil, "MONGOD_REPLSET_PORT must be a number, but is high."},
+		{"hexPort", map[string]string{"MONGOD_REPLSET_MEMBERS": "3", "MONGOD_REPLSET_PORT": "0x10"}, nil, "MONGOD_REPLSET_PORT must be a number, but is 0x10."},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			givenReplsetEnv(tc, c.env)
+
+			if c.err != "" {
+				tc.ShouldEvaluateToError(t, `return t.config()`, c.err)
+			} else {
+				tc.ShouldEvaluateTo(t, `return t.config()`, c.expected)
+			}
+		})
+	}
+}
+
+// TestReplset_config_agrees ensures that the connection string exported by
+// EnvKeys is the one of the replica set which mongod-replset starts.
+func TestReplset_config_agrees(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mongod-replset is not supported on Windows.")
+	}
+	tc := GivenContextWith(t, "../lib/replset.lua")
+	tc.OsType = "linux"
+	path := t.TempDir()
+	tc.ShouldEvaluateTo(t, `return t.install([[`+path+`]], "8.0.9")`, nil)
+
+	cases := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"defaults", map[string]string{"MONGOD_REPLSET_MEMBERS": "3"}},
+		{"empty", map[string]string{"MONGOD_REPLSET_MEMBERS": "2", "MONGOD_REPLSET_NAME": "", "MONGOD_REPLSET_PORT": "", "MONGOD_REPLSET_HOST": ""}},
+		{"custom", map[string]string{"MONGOD_REPLSET_MEMBERS": "1", "MONGOD_REPLSET_NAME": "dev", "MONGOD_REPLSET_PORT": "28000", "MONGOD_REPLSET_HOST": "dev.example.com", "MONGOD_BIND_IP": "0.0.0.0"}},
+		{"leadingZeros", map[string]string{"MONGOD_REPLSET_MEMBERS": "07", "MONGOD_REPLSET_PORT": "027018"}},
+		{"tooMany", map[string]string{"MONGOD_REPLSET_MEMBERS": "8"}},
+		{"negative", map[string]string{"MONGOD_REPLSET_MEMBERS": "-1"}},
+		{"fraction", map[string]string{"MONGOD_REPLSET_MEMBERS": "3.0"}},
+		{"hex", map[string]string{"MONGOD_REPLSET_MEMBERS": "0x3"}},
+		{"fractionPort", map[string]string{"MONGOD_REPLSET_MEMBERS": "3", "MONGOD_REPLSET_PORT": "27018.0"}},
+		{"hexPort", map[string]string{"MONGOD_REPLSET_MEMBERS": "3", "MONGOD_REPLSET_PORT": "0x10"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			givenReplsetEnv(tc, c.env)
+			expected := tc.ShouldEvaluate(t, `local ok, config = pcall(t.config)
+if not ok then
+	return (tostring(config):gsub("^[^:]+:%d+: ", ""))
+end
+return t.uri(config)`).(string)
+			expectedCode := 0
+			if !strings.HasPrefix(expected, "mongodb://") {
+				expectedCode = 2
+			}
+
+			cmd := exec.Command(filepath.Join(path, "bin", "mongod-replset"), "uri")
+			for _, kv := range os.Environ() {
+				if !strings.HasPrefix(kv, "MONGOD_") {
+					cmd.Env = append(cmd.Env, kv)
+				}
+			}
+			for k, v := range c.env {
+				cmd.Env = append(cmd.Env, k+"="+v)
+			}
+			assert.Equal(t, expected, ShouldExecCommand(t, expectedCode, cmd))
+		})
+	}
+}
+
+func TestReplset_uri(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/replset.lua")
+
+	tc.ShouldEvaluateTo(t, `return t.uri({name = "rs0", members = 3, port = 27018, host = "127.0.0.1"})`, "mongodb://127.0.0.1:27018,127.0.0.1:27019,127.0.0.1:27020/?replicaSet=rs0")
+	tc.ShouldEvaluateTo(t, `return t.uri({name = "dev", members = 1, port = 28000, host = "localhost"})`, "mongodb://localhost:28000/?replicaSet=dev")
+}
+
+func TestReplset_install(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/replset.lua")
+	tc.OsType = "linux"
+	dir := t.TempDir()
+	givenInstalledMongod(t, dir)
+
+	tc.ShouldEvaluateTo(t, `return t.install([[`+dir+`]], "8.0.9")`, nil)
+
+	template, err := os.ReadFile(filepath.Join(dir, "replset", "mongod.conf.template"))
+	require.NoError(t, err)
+	assert.Contains(t, string(template), "# Generated by vfox-mongod for mongod 8.0.9.")
+	assert.Contains(t, string(template), `keyFile: "@KEYFILE@"`)
+
+	fi, err := os.Stat(filepath.Join(dir, "bin", "mongod-replset"))
+	require.NoError(t, err)
+	assert.NotZero(t, fi.Mode()&0100, "mongod-replset should be executable.")
+	script, err := os.ReadFile(filepath.Join(dir, "bin", "mongod-replset"))
+	require.NoError(t, err)
+	assert.Contains(t, string(script), `"$home/bin/mongod" --config "$member/mongod.conf" --replSet "$name" --port "$member_port"`)
+	assert.Contains(t, string(script), `"$shell" --quiet --host "$advertised_host" --port "$port" --eval "$eval"`)
+	for _, placeholder := range []string{"@VERSION@", "@SHELL_FUNCTIONS@", "@KEYFILE_COMMAND@", "@MONGOD_COMMAND@", "@MONGOSH_COMMAND@"} {
+		assert.NotContains(t, string(script), placeholder)
+	}
+}
+
+func TestReplset_windows(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/replset.lua")
+	tc.OsType = "windows"
+	dir := t.TempDir()
+
+	tc.ShouldEvaluateTo(t, `return t.install([[`+dir+`]], "8.0.9")`, nil)
+	assert.NoDirExists(t, filepath.Join(dir, "replset"))
+	assert.NoFileExists(t, filepath.Join(dir, "bin", "mongod-replset"))
+	tc.ShouldEvaluateToError(t, `return t.start([[`+dir+`]], {name = "rs0", members = 1, port = 27018, host = "127.0.0.1", bind_ip = "127.0.0.1", dir = [[`+dir+`]]})`, "The replica set is currently not supported on Windows.")
+}
+
+// givenReplsetInstallation installs the replica set files into a new
+// directory and intercepts the start of members and the initiation.
+func givenReplsetInstallation(t testing.TB, tc *Context) (path string, dir string) {
+	t.Helper()
+	tc.OsType = "linux"
+	path, dir = t.TempDir(), filepath.Join(t.TempDir(), "rs")
+	tc.ShouldEvaluateTo(t, `return t.install([[`+path+`]], "8.0.9")`, nil)
+	tc.GivenCommandOutput(`/bin/mongod' --config `, "child process started successfully, parent exiting", 0)
+	tc.GivenCommandOutput(`^'mongosh' `, "", 0)
+	return path, dir
+}
+
+func TestReplset_start(t *testing.T) {
+	cases := []struct {
+		name     string
+		members  int
+		expected []string
+	}{
+		{"one", 1, []string{
+			`'@PATH@/bin/mongod' --config '@DIR@/member1/mongod.conf' --replSet 'rs0' --port 27018 2>&1`,
+			`'mongosh' --quiet --host 'localhost' --port 27018 --eval 'try { rs.status() } catch (e) { rs.initiate({_id: "rs0", members: [{_id: 0, host: "localhost:27018"}]}) }' 2>&1`,
+		}},
+		{"three", 3, []string{
+			`'@PATH@/bin/mongod' --config '@DIR@/member1/mongod.conf' --replSet 'rs0' --port 27018 2>&1`,
+			`'@PATH@/bin/mongod' --config '@DIR@/member2/mongod.conf' --replSet 'rs0' --port 27019 2>&1`,
+			`'@PATH@/bin/mongod' --config '@DIR@/member3/mongod.conf' --replSet 'rs0' --port 27020 2>&1`,
+			`'mongosh' --quiet --host 'localhost' --port 27018 --eval 'try { rs.status() } catch (e) { rs.initiate({_id: "rs0", members: [{_id: 0, host: "localhost:27018"}, {_id: 1, host: "localhost:27019"}, {_id: 2, host: "localhost:27020"}]}) }' 2>&1`,
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc := GivenContextWith(t, "../lib/replset.lua")
+			path, dir := givenReplsetInstallation(t, tc)
+
+			tc.ShouldEvaluateTo(t, `return t.start([[`+path+`]], {name = "rs0", members = `+strconv.Itoa(c.members)+`, port = 27018, host = "localhost", bind_ip = "127.0.0.1", dir = [[`+dir+`]]})`, nil)
+
+			replacer := strings.NewReplacer("@PATH@", path, "@DIR@", dir)
+			var expected []string
+			for _, command := range c.expected {
+				expected = append(expected, replacer.Replace(command))
+			}
+			assert.Equal(t, expected, tc.CommandsMatching(`mongod' --config |^'mongosh' `))
+
+			conf, err := os.ReadFile(filepath.Join(dir, "member"+strconv.Itoa(c.members), "mongod.conf"))
+			require.NoError(t, err)
+			assert.Contains(t, string(conf), `dbPath: `+strconv.Quote(filepath.Join(dir, "member"+strconv.Itoa(c.members), "data")))
+			assert.Contains(t, string(conf), `bindIp: "127.0.0.1"`)
+			assert.Contains(t, string(conf), `keyFile: `+strconv.Quote(filepath.Join(dir, "keyfile")))
+			assert.NotRegexp(t, `@[A-Z_]+@`, string(conf))
+			assert.DirExists(t, filepath.Join(dir, "member"+strconv.Itoa(c.members), "data"))
+
+			fi, err := os.Stat(filepath.Join(dir, "keyfile"))
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+			assert.Equal(t, int64(756), fi.Size())
+		})
+	}
+}
+
+func TestReplset_start_running(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/replset.lua")
+	path, dir := givenReplsetInstallation(t, tc)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "member1"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "member1", "mongod.pid"), []byte(strconv.Itoa(os.Getpid())+"\n"), 0644))
+
+	tc.ShouldEvaluateTo(t, `return t.start([[`+path+`]], {name = "rs0", members = 2, port = 27018, host = "127.0.0.1", bind_ip = "127.0.0.1", dir = [[`+dir+`]]})`, nil)
+	assert.Equal(t, []string{
+		"'" + path + "/bin/mongod' --config '" + dir + "/member2/mongod.conf' --replSet 'rs0' --port 27019 2>&1",
+	}, tc.CommandsMatching(`mongod' --config `), "Only the member which is not running should be started.")
+	assert.Len(t, tc.CommandsMatching(`^'mongosh' `), 1)
+
+	t.Run("all", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "member2", "mongod.pid"), []byte(strconv.Itoa(os.Getpid())+"\n"), 0644))
+		tc.ResetCommands()
+
+		tc.ShouldEvaluateTo(t, `return t.start([[`+path+`]], {name = "rs0", members = 2, port = 27018, host = "127.0.0.1", bind_ip = "127.0.0.1", dir = [[`+dir+`]]})`, nil)
+		assert.Empty(t, tc.CommandsMatching(`mongod' --config |^'mongosh' `), "A running replica set should neither be started nor initiated again.")
+	})
+}
+
+func TestReplset_start_failing(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/replset.lua")
+	path, dir := givenReplsetInstallation(t, tc)
+	tc.GivenCommandOutput(`/member2/mongod.conf' `, "ERROR: child process failed, exited with 48", 48)
+
+	tc.ShouldEvaluateToError(t, `return t.start([[`+path+`]], {name = "rs0", members = 3, port = 27018, host = "127.0.0.1", bind_ip = "127.0.0.1", dir = [[`+dir+`]]})`, "ERROR: child process failed, exited with 48")
+	assert.Len(t, tc.CommandsMatching(`mongod' --config `), 2, "Should stop at the first member which fails.")
+	assert.Empty(t, tc.CommandsMatching(`^'mongosh' `), "Should not initiate an incomplete replica set.")
+}
+
+func TestEnvKeys_replset(t *testing.T) {
+	tc := GivenPluginContext(t)
+	tc.OsType = "linux"
+	dir := t.TempDir()
+	givenReplsetEnv(tc, map[string]string{"MONGOD_REPLSET_MEMBERS": "2", "MONGOD_REPLSET_DIR": filepath.Join(dir, "rs")})
+	envKeys := `local result = {}
+for _, env in ipairs(PLUGIN:EnvKeys({path = [[` + dir + `]], version = "8.0.9"})) do
+	result[env.key] = env.value
+end
+return result`
+
+	tc.ShouldEvaluateTo(t, `return PLUGIN:EnvKeys({path = [[`+dir+`]], version = "8.0.9"})`, []any{
+		map[string]any{"key": "PATH", "value": dir + "/bin"},
+		map[string]any{"key": "MONGOD_HOME", "value": dir},
+		map[string]any{"key": "MONGOD_VERSION", "value": "8.0.9"},
+		map[string]any{"key": "MONGOD_REPLSET_URI", "value": "mongodb://127.0.0.1:27018,127.0.0.1:27019/?replicaSet=rs0"},
+	})
+	assert.Empty(t, tc.Commands(), "The activation should not start anything by default.")
+
+	t.Run("autostart", func(t *testing.T) {
+		tc.Setenv("MONGOD_REPLSET_AUTOSTART", "1")
+		defer tc.Setenv("MONGOD_REPLSET_AUTOSTART", "")
+		tc.ShouldEvaluateTo(t, `require("replset").install([[`+dir+`]], "8.0.9")
+return nil`, nil)
+		tc.GivenCommandOutput(`/bin/mongod' --config `, "child process started successfully, parent exiting", 0)
+		tc.GivenCommandOutput(`^'mongosh' `, "", 0)
+		tc.ResetCommands()
+
+		assert.Equal(t, "mongodb://127.0.0.1:27018,127.0.0.1:27019/?replicaSet=rs0", tc.ShouldEvaluate(t, envKeys).(map[string]any)["MONGOD_REPLSET_URI"])
+		assert.Len(t, tc.CommandsMatching(`/bin/mongod' --config `), 2)
+		assert.Len(t, tc.CommandsMatching(`^'mongosh' `), 1)
+
+		t.Run("failing", func(t *testing.T) {
+			require.NoError(t, os.RemoveAll(filepath.Join(dir, "rs")))
+			tc.GivenCommandOutput(`^'mongosh' `, "MongoServerSelectionError: connect ECONNREFUSED", 1)
+
+			assert.NotContains(t, tc.ShouldEvaluate(t, envKeys), "MONGOD_REPLSET_URI", "The URI of a replica set which did not start should not be exported.")
+			var warnings []string
+			for _, e := range tc.Logs() {
+				if strings.Contains(e.Message, "MongoServerSelectionError: connect ECONNREFUSED") {
+					warnings = append(warnings, e.Message)
+				}
+			}
+			require.Len(t, warnings, 1)
+		})
+	})
+
+	t.Run("illegal", func(t *testing.T) {
+		tc.Setenv("MONGOD_REPLSET_MEMBERS", "eight")
+
+		assert.NotContains(t, tc.ShouldEvaluate(t, envKeys), "MONGOD_REPLSET_URI")
+		require.Len(t, tc.LogsMatching("MONGOD_REPLSET_MEMBERS must be a number between 1 and 7, but is eight."), 1)
+	})
+}
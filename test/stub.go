@@ -0,0 +1,60 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var stubMongodBuild struct {
+	once sync.Once
+	fn   string
+	err  error
+	out  []byte
+}
+
+// BuildStubMongod builds cmd/mongod-stub (once per test binary) and returns
+// the path of the executable.
+func BuildStubMongod(t testing.TB) string {
+	t.Helper()
+	b := &stubMongodBuild
+	b.once.Do(func() {
+		dir, err := os.MkdirTemp("", "mongod-stub-")
+		if err != nil {
+			b.err = err
+			return
+		}
+		b.fn = filepath.Join(dir, "mongod"+exeExt())
+		cmd := exec.Command("go", "build", "-o", b.fn, "./cmd/mongod-stub")
+		b.out, b.err = cmd.CombinedOutput()
+	})
+	require.NoError(t, b.err, "Should build mongod-stub: %s", b.out)
+	return b.fn
+}
+
+// GivenStubMongod installs the stub of BuildStubMongod as bin/mongod (and
+// as mongosh/bin/mongosh) inside the given installation directory.
+func GivenStubMongod(t testing.TB, dir string) {
+	t.Helper()
+	content, err := os.ReadFile(BuildStubMongod(t))
+	require.NoError(t, err)
+	for _, fn := range []string{
+		filepath.Join(dir, "bin", "mongod"+exeExt()),
+		filepath.Join(dir, "mongosh", "bin", "mongosh"+exeExt()),
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		require.NoError(t, os.WriteFile(fn, content, 0755))
+	}
+}
+
+func exeExt() string {
+	if runtime.GOOS == "windows" {
+		return ".exe"
+	}
+	return ""
+}
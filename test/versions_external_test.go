@@ -11,6 +11,7 @@ import (
 
 func TestVersions_fetch_windows_External(t *testing.T) {
 	tc := GivenContextWith(t, "../lib/versions.lua")
+	tc.HTTP().AllowNetwork()
 	tc.OsType = "windows"
 	tc.ArchType = "amd64"
 
@@ -31,6 +32,7 @@ func TestVersions_fetch_windows_External(t *testing.T) {
 
 func TestVersions_fetch_macos_External(t *testing.T) {
 	tc := GivenContextWith(t, "../lib/versions.lua")
+	tc.HTTP().AllowNetwork()
 	tc.OsType = "darwin"
 	tc.ArchType = "arm64"
 
@@ -51,6 +53,7 @@ func TestVersions_fetch_macos_External(t *testing.T) {
 
 func TestVersions_fetch_ubuntu2402_External(t *testing.T) {
 	tc := GivenContextWith(t, "../lib/versions.lua")
+	tc.HTTP().AllowNetwork()
 	tc.OsType = "linux"
 	tc.ArchType = "arm64"
 	tc.DistributionType = "ubuntu"
@@ -73,6 +76,7 @@ func TestVersions_fetch_ubuntu2402_External(t *testing.T) {
 
 func TestVersions_fetch_debian12_External(t *testing.T) {
 	tc := GivenContextWith(t, "../lib/versions.lua")
+	tc.HTTP().AllowNetwork()
 	tc.OsType = "linux"
 	tc.ArchType = "amd64"
 	tc.DistributionType = "debian"
@@ -95,6 +99,7 @@ func TestVersions_fetch_debian12_External(t *testing.T) {
 
 func TestVersions_fetch_debian13_External(t *testing.T) {
 	tc := GivenContextWith(t, "../lib/versions.lua")
+	tc.HTTP().AllowNetwork()
 	tc.OsType = "linux"
 	tc.ArchType = "amd64"
 	tc.DistributionType = "debian"
@@ -0,0 +1,790 @@
+package test
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/echocat/slf4g/level"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	versionsUrl = "https://downloads.mongodb.org/full.json"
+
+	versionsFixtureMinimal = `{"versions": [{
+	"version": "8.0.0",
+	"production_release": true,
+	"lts_release": true,
+	"notes": "https://docs.mongodb.org/master/release-notes/8.0/",
+	"downloads": [{
+		"arch": "x86_64",
+		"edition": "base",
+		"target": "windows",
+		"archive": {
+			"url": "https://fastdl.mongodb.org/windows/mongodb-windows-x86_64-8.0.0.zip",
+			"sha1": "8f7c86737cda331c5ca9491c64707d887d69cb3b",
+			"sha256": "4745e9d31b9414a0c708630768532797578df705107604c69b27ebb679c4b595"
+		}
+	}, {
+		"arch": "x86_64",
+		"edition": "targeted",
+		"target": "ubuntu2404",
+		"archive": {
+			"url": "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2404-8.0.0.tgz",
+			"sha1": "0598b0b60f09d13ce58c788603b6867b85dc7f19",
+			"sha256": "6db634b3e6a0008722545bbd86f91ef27a6f428b37f4ee5479a0496afe50e7af"
+		}
+	}]
+}]}`
+)
+
+func TestVersions_fetch_faults(t *testing.T) {
+	cases := []struct {
+		name        string
+		fault       HttpFault
+		expectedErr string
+	}{
+		{"reset", HttpFault{Reset: true}, `Failed to fetch versions: Get "` + versionsUrl + `": read tcp: read: connection reset by peer`},
+		{"timeout", HttpFault{Timeout: true}, `Failed to fetch versions: Get "` + versionsUrl + `": read tcp: i/o timeout`},
+		{"serviceUnavailable", HttpFault{StatusCode: 503}, `Failed to fetch versions: ` + versionsUrl + ` returned status 503: Service Unavailable`},
+		{"notFound", HttpFault{StatusCode: 404, Body: []byte("<html>not here</html>")}, `Failed to fetch versions: ` + versionsUrl + ` returned status 404: <html>not here</html>`},
+		{"malformedBody", HttpFault{Body: []byte(`<html>`)}, `Failed to parse versions: invalid character '<' looking for beginning of value at line 1, column 1 (offset 0)`},
+		{"truncatedBody", HttpFault{TruncateBodyAfter: 10}, `Failed to fetch versions: unexpected EOF`},
+		{"withoutVersions", HttpFault{Body: []byte(`{"foo":"bar"}`)}, `Failed to parse versions: ` + versionsUrl + ` does not contain a list of versions`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tc := GivenContextWith(t, "../lib/versions.lua")
+			tc.HTTP().
+				GivenFixtureBody(versionsUrl, []byte(versionsFixtureMinimal)).
+				GivenFault(versionsUrl, c.fault)
+
+			tc.ShouldEvaluateToError(t, `return t.__fetch()`, c.expectedErr)
+		})
+	}
+}
+
+func TestVersions_fetch_recovers(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/versions.lua")
+	tc.HTTP().
+		GivenFixtureBody(versionsUrl, []byte(versionsFixtureMinimal)).
+		GivenFault(versionsUrl, HttpFault{StatusCode: 502, Times: 2})
+
+	tc.ShouldEvaluateToError(t, `return t.__fetch()`, `returned status 502`)
+	tc.ShouldEvaluateToError(t, `return t.__fetch()`, `returned status 502`)
+
+	actual := tc.ShouldEvaluate(t, `return t.__fetch()`)
+	require.IsType(t, map[string]any{}, actual)
+	assert.Contains(t, actual, "8.0.0")
+}
+
+func TestVersions_fetch_latency(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/versions.lua")
+	tc.HTTP().
+		GivenFixtureBody(versionsUrl, []byte(versionsFixtureMinimal)).
+		GivenFault(versionsUrl, HttpFault{Latency: 200 * time.Millisecond})
+
+	start := time.Now()
+	tc.ShouldEvaluateTo(t, `local _, latest = t.__fetch()
+return latest`, "8.0.0")
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestVersions_get_all_usesCache(t *testing.T) {
+	tc, _ := givenVersionsContext(t)
+	tc.HTTP().GivenFixtureBody(versionsUrl, []byte(versionsFixtureMinimal))
+
+	tc.ShouldEvaluateTo(t, `return #t.get_all()`, float64(1))
+	tc.ShouldEvaluateTo(t, `return t.get("latest").url`, "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2404-8.0.0.tgz")
+	tc.ShouldEvaluateTo(t, `return t.get("8.0.0").sha256`, "6db634b3e6a0008722545bbd86f91ef27a6f428b37f4ee5479a0496afe50e7af")
+
+	tc.HTTP().ShouldHaveRequested(t, versionsUrl, 1)
+	tc.HTTP().ShouldOnlyHaveRequestedHosts(t, "downloads.mongodb.org")
+}
+
+func TestVersions_get_all_revalidatesCache(t *testing.T) {
+	lastModified := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("storesValidators", func(t *testing.T) {
+		tc, fs := givenVersionsContext(t)
+		tc.HTTP().GivenFixtureContent(versionsUrl, `"v1"`, lastModified, []byte(versionsFixtureMinimal))
+
+		tc.ShouldEvaluateTo(t, `return #t.get_all()`, float64(1))
+
+		cache := readVersionsCache(t, fs)
+		assert.Equal(t, `"v1"`, cache["etag"])
+		assert.Equal(t, "Wed, 01 Oct 2025 12:00:00 GMT", cache["last_modified"])
+		assert.Equal(t, float64(versionsNow.Unix()), cache["created"])
+		assert.Empty(t, tc.HTTP().ShouldHaveRequested(t, versionsUrl, 1)[0].Header.Get("If-None-Match"))
+	})
+
+	t.Run("notModified", func(t *testing.T) {
+		tc, fs := givenVersionsContext(t)
+		tc.HTTP().GivenFixtureContent(versionsUrl, `"v1"`, lastModified, []byte(versionsFixtureMinimal))
+		givenVersionsCache(t, fs, `{"format":2,"created":`+versionsExpired+`,"etag":"\"v1\"","last_modified":"Wed, 01 Oct 2025 12:00:00 GMT","latest":"7.0.0","versions":{"7.0.0":{"url":"cached"}}}`)
+
+		tc.ShouldEvaluateTo(t, `return t.get("latest").url`, "cached")
+
+		requests := tc.HTTP().ShouldHaveRequested(t, versionsUrl, 1)
+		assert.Equal(t, `"v1"`, requests[0].Header.Get("If-None-Match"))
+		assert.Equal(t, "Wed, 01 Oct 2025 12:00:00 GMT", requests[0].Header.Get("If-Modified-Since"))
+		assert.Equal(t, http.StatusNotModified, requests[0].StatusCode)
+
+		cache := readVersionsCache(t, fs)
+		assert.Equal(t, float64(versionsNow.Unix()), cache["created"])
+		assert.Equal(t, `"v1"`, cache["etag"])
+
+		tc.ShouldEvaluateTo(t, `return t.get("7.0.0").url`, "cached")
+		tc.HTTP().ShouldHaveRequested(t, versionsUrl, 1)
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		tc, fs := givenVersionsContext(t)
+		tc.HTTP().GivenFixtureContent(versionsUrl, `"v2"`, lastModified, []byte(versionsFixtureMinimal))
+		givenVersionsCache(t, fs, `{"format":2,"created":`+versionsExpired+`,"etag":"\"v1\"","latest":"7.0.0","versions":{"7.0.0":{"url":"cached"}}}`)
+
+		tc.ShouldEvaluateTo(t, `return t.get("latest").version`, "8.0.0")
+
+		requests := tc.HTTP().ShouldHaveRequested(t, versionsUrl, 1)
+		assert.Equal(t, `"v1"`, requests[0].Header.Get("If-None-Match"))
+		assert.Equal(t, http.StatusOK, requests[0].StatusCode)
+		assert.Equal(t, `"v2"`, readVersionsCache(t, fs)["etag"])
+	})
+}
+
+func TestVersions_get_all_staleCache(t *testing.T) {
+	staleCache := `{"format":2,"created":` + versionsExpired + `,"latest":"7.0.0","versions":{"7.0.0":{"url":"cached"}}}`
+
+	t.Run("fallsBackIfFetchFails", func(t *testing.T) {
+		tc, fs := givenVersionsContext(t)
+		tc.HTTP().GivenFault(AnyUrl, HttpFault{Reset: true})
+		givenVersionsCache(t, fs, staleCache)
+
+		tc.ShouldEvaluateTo(t, `return t.get("latest").url`, "cached")
+
+		tc.HTTP().ShouldHaveRequested(t, versionsUrl, 1)
+		assert.Equal(t, staleCache, fs.ShouldReadFile(t, versionsCacheFile), "Stale cache should stay untouched.")
+		assert.Equal(t, []LogEntry{{
+			Level:   level.Warn,
+			Message: `Failed to fetch versions: Get "` + versionsUrl + `": read tcp: read: connection reset by peer; using the cached versions from 2025-10-17 12:00:00 UTC instead.`,
+			Fields:  map[string]any{},
+		}}, tc.Logs())
+	})
+
+	t.Run("fallsBackIfStatusIsUnexpected", func(t *testing.T) {
+		tc, fs := givenVersionsContext(t)
+		tc.HTTP().GivenFault(AnyUrl, HttpFault{StatusCode: 503})
+		givenVersionsCache(t, fs, staleCache)
+
+		tc.ShouldEvaluateTo(t, `return #t.get_all()`, float64(1))
+	})
+
+	t.Run("failsWithoutCache", func(t *testing.T) {
+		tc, fs := givenVersionsContext(t)
+		tc.HTTP().GivenFault(AnyUrl, HttpFault{Reset: true})
+
+		tc.ShouldEvaluateToError(t, `return t.get_all()`, `Failed to fetch versions: Get "`+versionsUrl+`": read tcp: read: connection reset by peer`)
+		assert.False(t, fs.Exists(versionsCacheFile))
+	})
+
+	t.Run("offlineUsesExpiredCache", func(t *testing.T) {
+		tc, fs := givenVersionsContext(t)
+		tc.Setenv("MONGOD_OFFLINE", "1")
+		givenVersionsCache(t, fs, staleCache)
+
+		tc.ShouldEvaluateTo(t, `return t.get("latest").url`, "cached")
+
+		tc.HTTP().ShouldNotHaveRequested(t, versionsUrl)
+	})
+
+	t.Run("offlineIgnoresIllegalCacheTtl", func(t *testing.T) {
+		tc, fs := givenVersionsContext(t)
+		tc.Setenv("MONGOD_OFFLINE", "1")
+		tc.Setenv("MONGOD_CACHE_TTL", "forever")
+		givenVersionsCache(t, fs, staleCache)
+
+		tc.ShouldEvaluateTo(t, `return t.get("latest").url`, "cached")
+	})
+
+	t.Run("offlineFailsWithoutCache", func(t *testing.T) {
+		tc, fs := givenVersionsContext(t)
+		tc.Setenv("MONGOD_OFFLINE", "1")
+
+		tc.ShouldEvaluateToError(t, `return t.get_all()`, `MONGOD_OFFLINE is set, but there are no cached versions in `+fs.Path(versionsCacheFile)+`.`)
+
+		tc.HTTP().ShouldNotHaveRequested(t, versionsUrl)
+	})
+}
+
+var (
+	versionsNow       = time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	versionsExpired   = strconv.FormatInt(versionsNow.Add(-48*time.Hour).Unix(), 10)
+	versionsCacheFile = filepath.Join("vfox-cache", "echocat-vfox-mongod", "versions-community-ubuntu2404-x86_64.json")
+)
+
+// givenVersionsContext creates a context for linux/ubuntu2404/x86_64 at
+// versionsNow with an empty Filesystem.
+func givenVersionsContext(t testing.TB) (*Context, *Filesystem) {
+	t.Helper()
+	tc := GivenContextWith(t, "../lib/versions.lua")
+	tc.OsType = "linux"
+	tc.DistributionType = "ubuntu"
+	tc.DistributionVersion = "24.4"
+	tc.GivenTime(versionsNow)
+
+	return tc, tc.GivenFilesystem(t)
+}
+
+func givenVersionsCache(t testing.TB, fs *Filesystem, content string) {
+	t.Helper()
+	fs.ShouldWriteFile(t, versionsCacheFile, content)
+}
+
+func readVersionsCache(t testing.TB, fs *Filesystem) map[string]any {
+	t.Helper()
+	var result map[string]any
+	require.NoError(t, json.Unmarshal([]byte(fs.ShouldReadFile(t, versionsCacheFile)), &result))
+	return result
+}
+
+func TestVersions___parse_duration(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/versions.lua")
+
+	cases := []struct {
+		given    string
+		expected any
+	}{
+		{"0", float64(0)},
+		{"90", float64(90)},
+		{"30s", float64(30)},
+		{"15m", float64(15 * 60)},
+		{" 12h ", float64(12 * 60 * 60)},
+		{"7d", float64(7 * 24 * 60 * 60)},
+		{"1h30m", float64(90 * 60)},
+		{"1.5h", float64(90 * 60)},
+		{"0s", float64(0)},
+		{"", nil},
+		{"12", float64(12)},
+		{"12w", nil},
+		{"h", nil},
+		{"-1h", nil},
+		{"1h foo", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.given, func(t *testing.T) {
+			tc.ShouldEvaluateTo(t, `return t.__parse_duration("`+c.given+`")`, c.expected)
+		})
+	}
+}
+
+func TestVersions_cache_ttl(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/versions.lua")
+
+	tc.ShouldEvaluateTo(t, `return t.cache_ttl()`, float64(24*60*60))
+
+	tc.Setenv("MONGOD_CACHE_TTL", "2h")
+	tc.ShouldEvaluateTo(t, `return t.cache_ttl()`, float64(2*60*60))
+
+	tc.Setenv("MONGOD_CACHE_TTL", "forever")
+	tc.ShouldEvaluateToError(t, `return t.cache_ttl()`, "MONGOD_CACHE_TTL must be a duration (like 12h, 30m or 0), but is forever.")
+}
+
+func TestVersions_get_all_cacheTtl(t *testing.T) {
+	tc, fs := givenVersionsContext(t)
+	tc.HTTP().GivenFixtureBody(versionsUrl, []byte(versionsFixtureMinimal))
+	cached := versionsNow.Add(-3 * time.Hour).Unix()
+	givenVersionsCache(t, fs, `{"format":2,"created":`+strconv.FormatInt(cached, 10)+`,"latest":"7.0.0","versions":{"7.0.0":{"url":"cached"}}}`)
+
+	tc.Setenv("MONGOD_CACHE_TTL", "4h")
+	tc.ShouldEvaluateTo(t, `return t.get("latest").url`, "cached")
+	tc.HTTP().ShouldNotHaveRequested(t, versionsUrl)
+
+	tc.Setenv("MONGOD_CACHE_TTL", "2h")
+	tc.ShouldEvaluateTo(t, `return t.get("latest").version`, "8.0.0")
+	tc.HTTP().ShouldHaveRequested(t, versionsUrl, 1)
+	assert.Equal(t, float64(versionsNow.Unix()), readVersionsCache(t, fs)["created"])
+
+	t.Run("disabled", func(t *testing.T) {
+		tc.Setenv("MONGOD_CACHE_TTL", "0")
+
+		tc.ShouldEvaluateTo(t, `return t.get("latest").version`, "8.0.0")
+		tc.ShouldEvaluateTo(t, `return t.get("latest").version`, "8.0.0")
+
+		tc.HTTP().ShouldHaveRequested(t, versionsUrl, 3)
+	})
+}
+
+// givenVersionsCaches writes caches of several targets, arches and editions:
+// one fresh, two expired and one of an older format.
+func givenVersionsCaches(t testing.TB, fs *Filesystem) {
+	t.Helper()
+	fresh := strconv.FormatInt(versionsNow.Add(-time.Hour).Unix(), 10)
+	fs.ShouldWriteFile(t, versionsCacheFile, `{"format":2,"created":`+fresh+`,"versions":{}}`)
+	fs.ShouldWriteFile(t, filepath.Join("vfox-cache", "echocat-vfox-mongod", "versions-enterprise-ubuntu2404-x86_64.json"), `{"format":2,"created":`+versionsExpired+`,"url":"https://mirror.example.com/full.json","versions":{}}`)
+	fs.ShouldWriteFile(t, filepath.Join("vfox-cache", "echocat-vfox-mongod", "versions-community-windows-x86_64.json"), `{"format":2,"created":`+versionsExpired+`,"versions":{}}`)
+	fs.ShouldWriteFile(t, filepath.Join("vfox-cache", "echocat-vfox-mongod", "versions-community-ubuntu2204-aarch64.json"), `{"created":`+fresh+`,"versions":{}}`)
+	fs.ShouldWriteFile(t, filepath.Join("vfox-cache", "echocat-vfox-mongod", "something-else.json"), `{}`)
+}
+
+func TestVersions_list_caches(t *testing.T) {
+	tc, fs := givenVersionsContext(t)
+	givenVersionsCaches(t, fs)
+	dir := fs.CacheDir()
+
+	tc.ShouldEvaluateTo(t, `return t.list_caches()`, []any{
+		map[string]any{"file": filepath.Join(dir, "versions-community-ubuntu2204-aarch64.json"), "edition": "community", "target": "ubuntu2204", "arch": "aarch64", "expired": true},
+		map[string]any{"file": filepath.Join(dir, "versions-community-ubuntu2404-x86_64.json"), "edition": "community", "target": "ubuntu2404", "arch": "x86_64", "expired": false, "url": versionsUrl, "created": float64(versionsNow.Add(-time.Hour).Unix())},
+		map[string]any{"file": filepath.Join(dir, "versions-community-windows-x86_64.json"), "edition": "community", "target": "windows", "arch": "x86_64", "expired": true, "url": versionsUrl, "created": float64(versionsNow.Add(-48 * time.Hour).Unix())},
+		map[string]any{"file": filepath.Join(dir, "versions-enterprise-ubuntu2404-x86_64.json"), "edition": "enterprise", "target": "ubuntu2404", "arch": "x86_64", "expired": true, "url": "https://mirror.example.com/full.json", "created": float64(versionsNow.Add(-48 * time.Hour).Unix())},
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		tc, _ := givenVersionsContext(t)
+		tc.ShouldEvaluateTo(t, `return #t.list_caches()`, float64(0))
+	})
+}
+
+func TestVersions_prune_caches(t *testing.T) {
+	tc, fs := givenVersionsContext(t)
+	givenVersionsCaches(t, fs)
+
+	tc.ShouldEvaluateTo(t, `local result = {}
+for _, entry in ipairs(t.prune_caches()) do
+	table.insert(result, entry.target .. "/" .. entry.arch .. " (" .. entry.edition .. ")")
+end
+return result`, []any{"ubuntu2204/aarch64 (community)", "windows/x86_64 (community)", "ubuntu2404/x86_64 (enterprise)"})
+
+	assert.True(t, fs.Exists(versionsCacheFile))
+	assert.True(t, fs.Exists(filepath.Join("vfox-cache", "echocat-vfox-mongod", "something-else.json")))
+	tc.ShouldEvaluateTo(t, `return #t.list_caches()`, float64(1))
+
+	t.Run("withShorterTtl", func(t *testing.T) {
+		tc.Setenv("MONGOD_CACHE_TTL", "30m")
+
+		tc.ShouldEvaluateTo(t, `return #t.prune_caches()`, float64(1))
+		assert.False(t, fs.Exists(versionsCacheFile))
+	})
+}
+
+func TestVersions_invalidate_caches(t *testing.T) {
+	tc, fs := givenVersionsContext(t)
+	givenVersionsCaches(t, fs)
+
+	tc.ShouldEvaluateTo(t, `return #t.invalidate_caches("windows")`, float64(1))
+	assert.False(t, fs.Exists(filepath.Join("vfox-cache", "echocat-vfox-mongod", "versions-community-windows-x86_64.json")))
+
+	tc.ShouldEvaluateTo(t, `return #t.invalidate_caches()`, float64(2))
+	assert.False(t, fs.Exists(versionsCacheFile))
+	assert.False(t, fs.Exists(filepath.Join("vfox-cache", "echocat-vfox-mongod", "versions-enterprise-ubuntu2404-x86_64.json")))
+
+	tc.ShouldEvaluateTo(t, `local result = {}
+for _, entry in ipairs(t.list_caches()) do
+	table.insert(result, entry.target)
+end
+return result`, []any{"ubuntu2204"})
+}
+
+func TestVersions_fetch_debug(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/versions.lua")
+	tc.OsType = "linux"
+	tc.Setenv("MONGOD_TARGET", "ubuntu2504")
+	tc.Setenv("MONGOD_DEBUG", "1")
+	tc.HTTP().GivenFixtureBody(versionsUrl, givenFullJson(givenFullJsonVersion{version: "8.0.9", production: true}))
+
+	tc.ShouldEvaluateTo(t, `return t.__fetch()["8.0.9"].url`, "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz")
+
+	var trail []string
+	for _, e := range tc.Logs() {
+		assert.Equal(t, level.Debug, e.Level)
+		trail = append(trail, fmt.Sprintf("%s %v", e.Message, e.Fields))
+	}
+	assert.Equal(t, []string{
+		"Target is overridden by MONGOD_TARGET. map[target:ubuntu2504]",
+		"Fetching versions. map[arch:x86_64 edition:community target:ubuntu2504 url:" + versionsUrl + "]",
+		"Download rejected: other edition. map[arch:x86_64 edition:enterprise target:windows version:8.0.9]",
+		"Download rejected: other edition. map[arch:x86_64 edition:enterprise target:macos version:8.0.9]",
+		"Download rejected: other edition. map[arch:x86_64 edition:enterprise target:ubuntu2404 version:8.0.9]",
+		"Download rejected: other arch. map[arch:aarch64 edition:targeted target:ubuntu2204 version:8.0.9]",
+		"Download rejected: other arch. map[arch:aarch64 edition:enterprise target:ubuntu2204 version:8.0.9]",
+		"Candidate rejected: other operating system or distribution. map[candidate:windows target:ubuntu2504]",
+		"Candidate rejected: other operating system or distribution. map[candidate:macos target:ubuntu2504]",
+		"Candidate is an older version of the same distribution; using it as fallback. map[candidate:ubuntu2404 target:ubuntu2504]",
+		"Download selected. map[target:ubuntu2404 url:https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz version:8.0.9]",
+	}, trail)
+
+	t.Run("disabled", func(t *testing.T) {
+		tc.ResetLogs()
+		tc.Setenv("MONGOD_DEBUG", "")
+
+		tc.ShouldEvaluate(t, `return t.__fetch()`)
+
+		assert.Empty(t, tc.Logs())
+	})
+}
+
+func TestVersions_fetch_lockdown(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/versions.lua")
+
+	tc.ShouldEvaluateToError(t, `return t.__fetch()`, `Failed to fetch versions: Get "`+versionsUrl+`": network lockdown: request to `+versionsUrl+` (called at ../lib/versions.lua:`)
+
+	violations := tc.HTTP().TakeLockdownViolations()
+	require.Len(t, violations, 1)
+	assert.ErrorContains(t, violations[0], "is not allowed")
+	tc.HTTP().ShouldHaveRequested(t, versionsUrl, 1)
+}
+
+func TestVersions_get_resolves(t *testing.T) {
+	fullJson := givenFullJson(
+		givenFullJsonVersion{version: "7.0.14", production: true, lts: true},
+		givenFullJsonVersion{version: "7.3.4", production: true},
+		givenFullJsonVersion{version: "8.0.0", production: true, lts: true},
+		givenFullJsonVersion{version: "8.0.9", production: true, lts: true},
+		givenFullJsonVersion{version: "8.0.10", production: true, lts: true},
+		givenFullJsonVersion{version: "8.0.11-rc0", rc: true, lts: true},
+		givenFullJsonVersion{version: "8.2.1", production: true, current: true},
+		givenFullJsonVersion{version: "8.3.0-rc1", rc: true},
+	)
+
+	cases := []struct {
+		given       string
+		withRcs     bool
+		expected    string
+		expectedErr string
+	}{
+		{given: "8.0.9", expected: "8.0.9"},
+		{given: "8.0.11-rc0", expected: "8.0.11-rc0"},
+		{given: "latest", expected: "8.2.1"},
+		{given: "current", expected: "8.2.1"},
+		{given: "lts", expected: "8.0.10"},
+		{given: "rapid", expected: "8.2.1"},
+		{given: "8", expected: "8.2.1"},
+		{given: "8.0", expected: "8.0.10"},
+		{given: "7", expected: "7.3.4"},
+		{given: "7.0", expected: "7.0.14"},
+		{given: "8.3", expectedErr: "Version 8.3 does not exist for ubuntu2404/x86_64"},
+		{given: "8.3", withRcs: true, expected: "8.3.0-rc1"},
+		{given: "8.0.1", expectedErr: "Version 8.0.1 does not exist for ubuntu2404/x86_64"},
+		{given: "9", expectedErr: "Version 9 does not exist for ubuntu2404/x86_64"},
+		{given: "80", expectedErr: "Version 80 does not exist for ubuntu2404/x86_64"},
+		{given: "foo", expectedErr: "Version foo does not exist for ubuntu2404/x86_64"},
+	}
+
+	for _, c := range cases {
+		name := c.given
+		if c.withRcs {
+			name += "_withRcs"
+		}
+		t.Run(name, func(t *testing.T) {
+			tc, _ := givenVersionsContext(t)
+			tc.HTTP().GivenFixtureBody(versionsUrl, fullJson)
+			if c.withRcs {
+				tc.Setenv("MONGOD_RELEASE_CANDIDATES", "1")
+			}
+
+			if expectedErr := c.expectedErr; expectedErr == "" {
+				tc.ShouldEvaluateTo(t, `return t.get("`+c.given+`").version`, c.expected)
+			} else {
+				tc.ShouldEvaluateToError(t, `return t.get("`+c.given+`")`, expectedErr)
+			}
+		})
+	}
+}
+
+type givenFullJsonVersion struct {
+	version                      string
+	production, lts, current, rc bool
+
+	// checksums returns the checksums of the archive of the given url; empty
+	// ones are omitted. If nil, the checksums of the url itself are used.
+	checksums func(url string) (sha1, sha256 string)
+}
+
+// givenFullJson synthesizes a full.json (like the one of
+// downloads.mongodb.org) which offers every given version in the community
+// and enterprise edition for windows, macos and ubuntu2404 on x86_64 and for
+// ubuntu2204 on aarch64.
+func givenFullJson(versions ...givenFullJsonVersion) []byte {
+	type archive struct {
+		Url    string `json:"url"`
+		Sha1   string `json:"sha1,omitempty"`
+		Sha256 string `json:"sha256,omitempty"`
+	}
+	type download struct {
+		Arch    string  `json:"arch"`
+		Edition string  `json:"edition"`
+		Target  string  `json:"target"`
+		Archive archive `json:"archive"`
+	}
+	type version struct {
+		Version           string     `json:"version"`
+		ProductionRelease bool       `json:"production_release"`
+		LtsRelease        bool       `json:"lts_release"`
+		Current           bool       `json:"current"`
+		ReleaseCandidate  bool       `json:"release_candidate"`
+		Notes             string     `json:"notes"`
+		Downloads         []download `json:"downloads"`
+	}
+
+	result := struct {
+		Versions []version `json:"versions"`
+	}{}
+	for _, v := range versions {
+		newArchive := func(url string) archive {
+			if v.checksums != nil {
+				sha1Sum, sha256Sum := v.checksums(url)
+				return archive{Url: url, Sha1: sha1Sum, Sha256: sha256Sum}
+			}
+			sha1Sum := sha1.Sum([]byte(url))
+			sha256Sum := sha256.Sum256([]byte(url))
+			return archive{
+				Url:    url,
+				Sha1:   hex.EncodeToString(sha1Sum[:]),
+				Sha256: hex.EncodeToString(sha256Sum[:]),
+			}
+		}
+		result.Versions = append(result.Versions, version{
+			Version:           v.version,
+			ProductionRelease: v.production,
+			LtsRelease:        v.lts,
+			Current:           v.current,
+			ReleaseCandidate:  v.rc,
+			Notes:             "https://docs.mongodb.org/master/release-notes/" + v.version + "/",
+			Downloads: []download{{
+				Arch:    "x86_64",
+				Edition: "base",
+				Target:  "windows",
+				Archive: newArchive("https://fastdl.mongodb.org/windows/mongodb-windows-x86_64-" + v.version + ".zip"),
+			}, {
+				Arch:    "x86_64",
+				Edition: "enterprise",
+				Target:  "windows",
+				Archive: newArchive("https://downloads.mongodb.com/windows/mongodb-windows-x86_64-enterprise-" + v.version + ".zip"),
+			}, {
+				Arch:    "x86_64",
+				Edition: "base",
+				Target:  "macos",
+				Archive: newArchive("https://fastdl.mongodb.org/osx/mongodb-macos-x86_64-" + v.version + ".tgz"),
+			}, {
+				Arch:    "x86_64",
+				Edition: "enterprise",
+				Target:  "macos",
+				Archive: newArchive("https://downloads.mongodb.com/osx/mongodb-macos-x86_64-enterprise-" + v.version + ".tgz"),
+			}, {
+				Arch:    "x86_64",
+				Edition: "targeted",
+				Target:  "ubuntu2404",
+				Archive: newArchive("https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2404-" + v.version + ".tgz"),
+			}, {
+				Arch:    "x86_64",
+				Edition: "enterprise",
+				Target:  "ubuntu2404",
+				Archive: newArchive("https://downloads.mongodb.com/linux/mongodb-linux-x86_64-enterprise-ubuntu2404-" + v.version + ".tgz"),
+			}, {
+				Arch:    "aarch64",
+				Edition: "targeted",
+				Target:  "ubuntu2204",
+				Archive: newArchive("https://fastdl.mongodb.org/linux/mongodb-linux-aarch64-ubuntu2204-" + v.version + ".tgz"),
+			}, {
+				Arch:    "aarch64",
+				Edition: "enterprise",
+				Target:  "ubuntu2204",
+				Archive: newArchive("https://downloads.mongodb.com/linux/mongodb-linux-aarch64-enterprise-ubuntu2204-" + v.version + ".tgz"),
+			}},
+		})
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func TestVersions_get_all_ordered(t *testing.T) {
+	tc, _ := givenVersionsContext(t)
+	tc.HTTP().GivenFixtureBody(versionsUrl, givenFullJson(
+		givenFullJsonVersion{version: "8.0.9", production: true},
+		givenFullJsonVersion{version: "8.2.0-rc10", rc: true},
+		givenFullJsonVersion{version: "10.0.0", production: true},
+		givenFullJsonVersion{version: "8.0.10", production: true},
+		givenFullJsonVersion{version: "8.2.0-rc2", rc: true},
+		givenFullJsonVersion{version: "7.0.14", production: true},
+		givenFullJsonVersion{version: "8.2.0", production: true},
+		givenFullJsonVersion{version: "9.0.0", production: true},
+		givenFullJsonVersion{version: "8.2.0-rc1", rc: true},
+		givenFullJsonVersion{version: "8.1.3", production: true},
+		givenFullJsonVersion{version: "8.2.0-alpha1", rc: true},
+	))
+
+	tc.ShouldEvaluateTo(t, `local result = {}
+for _, v in ipairs(t.get_all()) do
+	table.insert(result, v.version)
+end
+return result`, []any{
+		"10.0.0",
+		"9.0.0",
+		"8.2.0",
+		"8.2.0-rc10",
+		"8.2.0-rc2",
+		"8.2.0-rc1",
+		"8.2.0-alpha1",
+		"8.1.3",
+		"8.0.10",
+		"8.0.9",
+		"7.0.14",
+	})
+}
+
+func TestVersions_latest_orderedLikeGetAll(t *testing.T) {
+	tc, _ := givenVersionsContext(t)
+	tc.HTTP().GivenFixtureBody(versionsUrl, givenFullJson(
+		givenFullJsonVersion{version: "8.2.0-rc2", production: true},
+		givenFullJsonVersion{version: "8.2.0-rc10", production: true},
+		givenFullJsonVersion{version: "8.1.3", production: true},
+	))
+
+	tc.ShouldEvaluateTo(t, `local _, latest = t.__get_all()
+return {latest, t.get_all()[1].version}`, []any{"8.2.0-rc10", "8.2.0-rc10"})
+}
+
+func TestVersions_availableOrderedLikeResolve(t *testing.T) {
+	tc := GivenPluginContext(t)
+	tc.OsType = "linux"
+	tc.DistributionType = "ubuntu"
+	tc.DistributionVersion = "24.4"
+	tc.GivenTime(versionsNow)
+	tc.GivenFilesystem(t)
+	tc.Setenv("MONGOD_RELEASE_CANDIDATES", "1")
+	tc.HTTP().GivenFixtureBody(versionsUrl, givenFullJson(
+		givenFullJsonVersion{version: "8.2.0-rc2", rc: true},
+		givenFullJsonVersion{version: "8.2.0-rc10", rc: true},
+		givenFullJsonVersion{version: "8.2.0-alpha1", rc: true},
+		givenFullJsonVersion{version: "8.2.0-rc1", rc: true},
+	))
+
+	// Resolving 8.2 again and again, each time without the version resolved
+	// before, has to result in the order of Available.
+	tc.ShouldEvaluateTo(t, `local versions = require("versions")
+local all, latest = versions.__get_all()
+local available, resolved = {}, {}
+for _, v in ipairs(PLUGIN:Available({})) do
+	table.insert(available, v.version)
+end
+while true do
+	local version = versions.__resolve("8.2", all, latest)
+	if not version then
+		break
+	end
+	table.insert(resolved, version)
+	all[version] = nil
+end
+return {available, resolved}`, []any{
+		[]any{"8.2.0-rc10", "8.2.0-rc2", "8.2.0-rc1", "8.2.0-alpha1"},
+		[]any{"8.2.0-rc10", "8.2.0-rc2", "8.2.0-rc1", "8.2.0-alpha1"},
+	})
+}
+
+func TestVersions___cmp(t *testing.T) {
+	tc := GivenContextWith(t, "../lib/versions.lua")
+
+	cases := []struct {
+		a, b     string
+		expected float64
+	}{
+		{"8.0.10", "8.0.9", 1},
+		{"8.0.9", "8.0.10", -1},
+		{"10.0.0", "9.0.0", 1},
+		{"8.2.0", "8.2.0-rc1", 1},
+		{"8.2.0-rc1", "8.2.0", -1},
+		{"8.2.0-rc10", "8.2.0-rc2", 1},
+		{"8.2.0-rc2", "8.2.0-rc2", 0},
+		{"8.2.0-rc1", "8.1.9", 1},
+		{"8.2.0-rc1", "8.2.0-alpha1", 1},
+		{"8.2.0", "foo", 1},
+		{"foo", "8.2.0", -1},
+		{"foo", "foo", 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.a+"_"+c.b, func(t *testing.T) {
+			tc.ShouldEvaluateTo(t, `return t.__cmp("`+c.a+`", "`+c.b+`")`, c.expected)
+		})
+	}
+}
+
+func TestVersions_get_editions(t *testing.T) {
+	fullJson := givenFullJson(
+		givenFullJsonVersion{version: "8.0.9", production: true, lts: true},
+	)
+
+	// The filesystem only works with linux, so other operating systems are
+	// selected by MONGOD_TARGET.
+	cases := []struct {
+		edition      string
+		target       string
+		version      string
+		archType     string
+		expectedUrl  string
+		expectedFile string
+	}{
+		{"", "windows", "", "amd64", "https://fastdl.mongodb.org/windows/mongodb-windows-x86_64-8.0.9.zip", "versions-community-windows-x86_64.json"},
+		{"community", "windows", "", "amd64", "https://fastdl.mongodb.org/windows/mongodb-windows-x86_64-8.0.9.zip", "versions-community-windows-x86_64.json"},
+		{"enterprise", "windows", "", "amd64", "https://downloads.mongodb.com/windows/mongodb-windows-x86_64-enterprise-8.0.9.zip", "versions-enterprise-windows-x86_64.json"},
+		{"community", "macos", "", "amd64", "https://fastdl.mongodb.org/osx/mongodb-macos-x86_64-8.0.9.tgz", "versions-community-macos-x86_64.json"},
+		{"Enterprise", "macos", "", "amd64", "https://downloads.mongodb.com/osx/mongodb-macos-x86_64-enterprise-8.0.9.tgz", "versions-enterprise-macos-x86_64.json"},
+		{"community", "", "24.4", "amd64", "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz", "versions-community-ubuntu2404-x86_64.json"},
+		{"enterprise", "", "24.4", "amd64", "https://downloads.mongodb.com/linux/mongodb-linux-x86_64-enterprise-ubuntu2404-8.0.9.tgz", "versions-enterprise-ubuntu2404-x86_64.json"},
+		{"community", "", "25.4", "amd64", "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2404-8.0.9.tgz", "versions-community-ubuntu2504-x86_64.json"},
+		{"enterprise", "", "25.4", "amd64", "https://downloads.mongodb.com/linux/mongodb-linux-x86_64-enterprise-ubuntu2404-8.0.9.tgz", "versions-enterprise-ubuntu2504-x86_64.json"},
+		{"community", "", "22.4", "arm64", "https://fastdl.mongodb.org/linux/mongodb-linux-aarch64-ubuntu2204-8.0.9.tgz", "versions-community-ubuntu2204-aarch64.json"},
+		{"enterprise", "", "24.4", "arm64", "https://downloads.mongodb.com/linux/mongodb-linux-aarch64-enterprise-ubuntu2204-8.0.9.tgz", "versions-enterprise-ubuntu2404-aarch64.json"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.edition+"/"+c.target+c.version+"/"+c.archType, func(t *testing.T) {
+			tc, fs := givenVersionsContext(t)
+			tc.ArchType = c.archType
+			tc.DistributionVersion = c.version
+			if c.target != "" {
+				tc.Setenv("MONGOD_TARGET", c.target)
+			}
+			tc.Setenv("MONGOD_EDITION", c.edition)
+			tc.HTTP().GivenFixtureBody(versionsUrl, fullJson)
+
+			tc.ShouldEvaluateTo(t, `return t.get("8.0.9").url`, c.expectedUrl)
+			assert.True(t, fs.Exists(filepath.Join("vfox-cache", "echocat-vfox-mongod", c.expectedFile)), "Cache file %s should exist.", c.expectedFile)
+		})
+	}
+
+	t.Run("cachesEditionsSeparately", func(t *testing.T) {
+		tc, _ := givenVersionsContext(t)
+		tc.HTTP().GivenFixtureBody(versionsUrl, fullJson)
+
+		tc.ShouldEvaluateTo(t, `return t.get("8.0.9").edition`, "targeted")
+		tc.Setenv("MONGOD_EDITION", "enterprise")
+		tc.ShouldEvaluateTo(t, `return t.get("8.0.9").edition`, "enterprise")
+		tc.Setenv("MONGOD_EDITION", "community")
+		tc.ShouldEvaluateTo(t, `return t.get("8.0.9").edition`, "targeted")
+
+		tc.HTTP().ShouldHaveRequested(t, versionsUrl, 2)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		tc, _ := givenVersionsContext(t)
+		tc.Setenv("MONGOD_EDITION", "atlas")
+
+		tc.ShouldEvaluateToError(t, `return t.get("8.0.9")`, "Unsupported edition: atlas")
+		tc.HTTP().ShouldNotHaveRequested(t, versionsUrl)
+	})
+}